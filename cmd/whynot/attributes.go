@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	gmast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	gmtext "github.com/yuin/goldmark/text"
+)
+
+// parseAttributes parses an attribute list in braces, e.g.
+//
+//	{width=300 .float-left}
+//
+// at the start of s.  It returns the attributes and the rest of s.
+func parseAttributes(s []byte) (parser.Attributes, []byte, bool) {
+	reader := gmtext.NewReader(s)
+	attrs, ok := parser.ParseAttributes(reader)
+	if !ok {
+		return nil, s, false
+	}
+	_, pos := reader.Position()
+	return attrs, s[pos.Start:], true
+}
+
+// nodeAttributes returns the attributes of a node, as parsed by the
+// attribute option of the parser, e.g. on headings.
+func nodeAttributes(node gmast.Node) parser.Attributes {
+	var attrs parser.Attributes
+	for _, a := range node.Attributes() {
+		attrs = append(attrs, parser.Attribute{Name: a.Name, Value: a.Value})
+	}
+	return attrs
+}
+
+func attrString(attrs parser.Attributes, name string) (string, bool) {
+	v, ok := attrs.Find([]byte(name))
+	if !ok {
+		return "", false
+	}
+	switch x := v.(type) {
+	case []byte:
+		return string(x), true
+	case string:
+		return x, true
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(x), true
+	}
+	return "", false
+}
+
+func attrFloat(attrs parser.Attributes, name string) (float64, bool) {
+	s, ok := attrString(attrs, name)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(strings.TrimSuffix(s, "px"), 64)
+	return f, err == nil
+}
+
+func attrHasClass(attrs parser.Attributes, class string) bool {
+	classes, _ := attrString(attrs, "class")
+	for _, c := range strings.Fields(classes) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLineRanges parses a list of line numbers and ranges such as "1 3-5" or
+// "1,3-5" and marks the given lines, counting from first, in a slice of n
+// flags.
+func parseLineRanges(s string, first, n int) []bool {
+	lines := make([]bool, n)
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		from, to, isRange := strings.Cut(field, "-")
+		lo, err := strconv.Atoi(from)
+		if err != nil {
+			continue
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(to); err != nil {
+				continue
+			}
+		}
+		lo, hi = maxInt(lo, first), minInt(hi, first+n-1)
+		for i := lo; i <= hi; i++ {
+			lines[i-first] = true
+		}
+	}
+	return lines
+}
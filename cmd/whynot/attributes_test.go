@@ -0,0 +1,36 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLineRanges(t *testing.T) {
+	tests := []struct {
+		s        string
+		first, n int
+		want     []bool
+	}{
+		{"", 1, 3, []bool{false, false, false}},
+		{"2", 1, 3, []bool{false, true, false}},
+		{"1 3", 1, 3, []bool{true, false, true}},
+		{"1,3", 1, 3, []bool{true, false, true}},
+		{"2-4", 1, 5, []bool{false, true, true, true, false}},
+		{"1, 4-5", 1, 5, []bool{true, false, false, true, true}},
+		{"10-12", 10, 4, []bool{true, true, true, false}},
+		{"4-2", 1, 5, []bool{false, false, false, false, false}},
+		// Lines out of the block are left out.
+		{"0 7", 1, 5, []bool{false, false, false, false, false}},
+		{"3-100", 1, 5, []bool{false, false, true, true, true}},
+		{"-2", 1, 3, []bool{false, false, false}},
+		{"0-2", 1, 3, []bool{true, true, false}},
+		// Fields that aren't numbers are ignored.
+		{"x 2 y-3 1-z", 1, 3, []bool{false, true, false}},
+		{"1", 1, 0, []bool{}},
+	}
+	for _, test := range tests {
+		if got := parseLineRanges(test.s, test.first, test.n); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseLineRanges(%q, %d, %d) = %v, want %v", test.s, test.first, test.n, got, test.want)
+		}
+	}
+}
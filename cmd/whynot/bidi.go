@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/bidi"
+)
+
+// Inline boxes that carry a resolved bidi embedding level implement this.
+// Boxes that don't are treated as being at the paragraph level.
+type bidiLeveled interface {
+	BidiLevel() int
+}
+
+// paragraphLevel returns the base embedding level of a paragraph, following
+// rules P2 and P3 of UAX #9: the direction of the first strong character.
+func paragraphLevel(text string) int {
+	for _, r := range text {
+		props, _ := bidi.LookupRune(r)
+		switch props.Class() {
+		case bidi.L:
+			return 0
+		case bidi.R, bidi.AL:
+			return 1
+		}
+	}
+	return 0
+}
+
+// resolveBidiLevels runs the bidi algorithm over the text of the given inline
+// items, assigns an embedding level to each of them and returns the base level
+// of the paragraph.  Levels are resolved per item so each word is drawn as a
+// single directional run.
+func resolveBidiLevels(items []Inline) int {
+	var sb strings.Builder
+	starts := make([]int, len(items))
+	pos := 0
+	for i, item := range items {
+		if i > 0 {
+			sb.WriteByte(' ')
+			pos++
+		}
+		starts[i] = pos
+		var s string
+		switch x := item.(type) {
+		case *InlineText:
+			s = x.text
+		default:
+			s = "\ufffc"
+		}
+		sb.WriteString(s)
+		pos += utf8.RuneCountInString(s)
+	}
+	text := sb.String()
+	baseLevel := paragraphLevel(text)
+
+	var p bidi.Paragraph
+	if _, err := p.SetString(text); err != nil {
+		return baseLevel
+	}
+	ordering, err := p.Order()
+	if err != nil || ordering.NumRuns() == 0 {
+		return baseLevel
+	}
+	run := 0
+	for i, item := range items {
+		for {
+			r := ordering.Run(run)
+			if _, end := r.Pos(); end >= starts[i] || run == ordering.NumRuns()-1 {
+				break
+			}
+			run++
+		}
+		r := ordering.Run(run)
+		level := baseLevel
+		if r.Direction() == bidi.RightToLeft && baseLevel%2 == 0 {
+			level++
+		} else if r.Direction() == bidi.LeftToRight && baseLevel%2 == 1 {
+			level++
+		}
+		switch x := item.(type) {
+		case *InlineText:
+			x.level = level
+		case *InlineImage:
+			x.level = level
+		}
+	}
+	return baseLevel
+}
+
+// reorderBoxes returns the boxes of a line in visual order, applying rule L2
+// of UAX #9: from the highest level down to the lowest odd level, reverse
+// every maximal sequence of boxes at that level or higher.
+func reorderBoxes(boxes []InlineBox, baseLevel int) []InlineBox {
+	levels := make([]int, len(boxes))
+	highest, lowestOdd := baseLevel, baseLevel|1
+	for i, box := range boxes {
+		level := baseLevel
+		if lb, ok := box.(bidiLeveled); ok {
+			level = lb.BidiLevel()
+		}
+		levels[i] = level
+		if level > highest {
+			highest = level
+		}
+		if level%2 == 1 && level < lowestOdd {
+			lowestOdd = level
+		}
+	}
+	if highest == 0 {
+		return boxes
+	}
+	visual := make([]InlineBox, len(boxes))
+	copy(visual, boxes)
+	for level := highest; level >= lowestOdd; level-- {
+		for i := 0; i < len(visual); {
+			if levels[i] < level {
+				i++
+				continue
+			}
+			j := i
+			for j < len(visual) && levels[j] >= level {
+				j++
+			}
+			reverseSlice(visual[i:j])
+			reverseSlice(levels[i:j])
+			i = j
+		}
+	}
+	return visual
+}
+
+func reverseSlice[T any](s []T) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+// directedMargins mirrors the horizontal margins of right to left blocks.
+func directedMargins(m Margins, level int) Margins {
+	if level%2 == 1 {
+		m.Left, m.Right = m.Right, m.Left
+	}
+	return m
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParagraphLevel(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"hello", 0},
+		{"שלום world", 1},
+		{"123 hello שלום", 0},
+		{"42 مرحبا", 1},
+		{"", 0},
+		{"123 ...", 0},
+	}
+	for _, test := range tests {
+		if got := paragraphLevel(test.text); got != test.want {
+			t.Errorf("paragraphLevel(%q) = %d, want %d", test.text, got, test.want)
+		}
+	}
+}
+
+func TestResolveBidiLevels(t *testing.T) {
+	tests := []struct {
+		words []string
+		base  int
+		want  []int
+	}{
+		{[]string{"hello", "world"}, 0, []int{0, 0}},
+		{[]string{"hello", "שלום", "עולם", "world"}, 0, []int{0, 1, 1, 0}},
+		{[]string{"שלום", "big", "עולם"}, 1, []int{1, 2, 1}},
+		{[]string{"مرحبا", "بالعالم"}, 1, []int{1, 1}},
+	}
+	for _, test := range tests {
+		items := make([]Inline, len(test.words))
+		for i, w := range test.words {
+			items[i] = &InlineText{text: w}
+		}
+		base := resolveBidiLevels(items)
+		levels := make([]int, len(items))
+		for i, item := range items {
+			levels[i] = item.(*InlineText).level
+		}
+		if base != test.base || !reflect.DeepEqual(levels, test.want) {
+			t.Errorf("%q: got base %d and levels %v, want %d and %v", test.words, base, levels, test.base, test.want)
+		}
+	}
+}
+
+func TestResolveBidiLevelsImage(t *testing.T) {
+	img := &InlineImage{}
+	items := []Inline{&InlineText{text: "שלום"}, img, &InlineText{text: "עולם"}}
+	if base := resolveBidiLevels(items); base != 1 {
+		t.Errorf("base level = %d, want 1", base)
+	}
+	if img.level != 1 {
+		t.Errorf("image level = %d, want 1", img.level)
+	}
+}
+
+// leveledBox is an inline box that only has a name and a bidi level.
+type leveledBox struct {
+	InlineBox
+	name  string
+	level int
+}
+
+func (b *leveledBox) BidiLevel() int {
+	return b.level
+}
+
+func TestReorderBoxes(t *testing.T) {
+	tests := []struct {
+		levels []int
+		base   int
+		want   string
+	}{
+		{[]int{0, 0, 0}, 0, "abc"},
+		{[]int{1, 1, 1}, 1, "cba"},
+		{[]int{0, 1, 1, 0}, 0, "acbd"},
+		{[]int{1, 2, 2, 1}, 1, "dbca"},
+		{[]int{0, 1, 2, 2, 1, 0}, 0, "aecdbf"},
+		{[]int{}, 0, ""},
+	}
+	for _, test := range tests {
+		boxes := make([]InlineBox, len(test.levels))
+		for i, level := range test.levels {
+			boxes[i] = &leveledBox{name: string(rune('a' + i)), level: level}
+		}
+		got := ""
+		for _, box := range reorderBoxes(boxes, test.base) {
+			got += box.(*leveledBox).name
+		}
+		if got != test.want {
+			t.Errorf("levels %v: got %q, want %q", test.levels, got, test.want)
+		}
+	}
+}
+
+func TestReorderBoxesUnleveled(t *testing.T) {
+	// Boxes without a level are at the level of the paragraph.
+	a, b := &leveledBox{name: "a", level: 1}, &struct{ InlineBox }{}
+	got := reorderBoxes([]InlineBox{a, b}, 1)
+	if got[0] != b || got[1] != a {
+		t.Errorf("got %v, want the boxes reversed", got)
+	}
+}
+
+func TestDirectedMargins(t *testing.T) {
+	m := Margins{Top: 1, Bottom: 2, Left: 3, Right: 4}
+	if got := directedMargins(m, 0); got != m {
+		t.Errorf("left to right margins = %v, want %v", got, m)
+	}
+	want := Margins{Top: 1, Bottom: 2, Left: 4, Right: 3}
+	if got := directedMargins(m, 1); got != want {
+		t.Errorf("right to left margins = %v, want %v", got, want)
+	}
+}
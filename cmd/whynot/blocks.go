@@ -4,13 +4,28 @@ import (
 	"image"
 	"image/color"
 	"math"
+	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"golang.org/x/image/math/fixed"
 )
 
 type RenderingContext struct {
 	Scale float64
 	FaceSelector
+
+	// When not zero, line heights and the gaps between blocks are rounded
+	// up to multiples of this (unscaled) height, so that body text lines up
+	// across blocks.
+	BaselineGrid float64
+
+	// The minimum number of lines of a paragraph left at the bottom and at
+	// the top of a column or page when it is broken.
+	Orphans, Widows int
+}
+
+func (c RenderingContext) gridSize() int {
+	return int(math.Round(c.BaselineGrid * c.Scale))
 }
 
 func (c RenderingContext) ScaleMargins(m Margins) Margins {
@@ -25,12 +40,115 @@ type Margins struct {
 	Top, Bottom, Left, Right float64
 }
 
+// A LineHeight is either a multiple of the font size or an absolute (unscaled)
+// height.  The zero value means the natural height of the font.  As in CSS,
+// the difference with the height of the font is split equally above and
+// below the text.
+type LineHeight struct {
+	Multiplier float64
+	Absolute   float64
+}
+
+func (h LineHeight) halfLeading(ctx RenderingContext, face *Face) fixed.Int26_6 {
+	var height fixed.Int26_6
+	switch {
+	case h.Multiplier != 0:
+		height = fixed.Int26_6(h.Multiplier * float64(face.ppem))
+	case h.Absolute != 0:
+		height = fixed.Int26_6(h.Absolute * ctx.Scale * 64)
+	default:
+		return 0
+	}
+	metrics := face.Metrics()
+	return (height - metrics.Ascent - metrics.Descent) / 2
+}
+
+// Inline boxes that can shrink to fit the width of a line implement this.
+type widthFitter interface {
+	FitWidth(maxWidth int)
+}
+
+// getInlineBoxes returns the boxes for the inline parts, with the leading
+// given by the line height and no wider than width.
+func getInlineBoxes(ctx RenderingContext, parts []Inline, lineHeight LineHeight, width int) []InlineBox {
+	boxes := make([]InlineBox, len(parts))
+	for i, part := range parts {
+		boxes[i] = part.GetInlineBox(ctx)
+		setLeading(ctx, boxes[i], lineHeight)
+		if f, ok := boxes[i].(widthFitter); ok {
+			f.FitWidth(width)
+		}
+	}
+	return boxes
+}
+
+func setLeading(ctx RenderingContext, box InlineBox, lineHeight LineHeight) {
+	switch b := box.(type) {
+	case *TextBox:
+		b.Leading = lineHeight.halfLeading(ctx, b.Face)
+	case *ListItemMarkerBox:
+		setLeading(ctx, b.Marker, lineHeight)
+	case *SpansBox:
+		for _, span := range b.Spans {
+			setLeading(ctx, span, lineHeight)
+		}
+	}
+}
+
+// unselectable marks text that isn't part of the document, such as line
+// numbers, so that it isn't selected or copied.
+func unselectable(box InlineBox) InlineBox {
+	if t, ok := box.(*TextBox); ok {
+		t.noSelect = true
+	}
+	return box
+}
+
+// Blocks are measured, which tells the range of widths they can usefully
+// take, then laid out within constraints.
 type Block interface {
-	GetBounds(ctx RenderingContext, width int) image.Rectangle
-	GetBox(ctx RenderingContext, width int) Box
+	// Measure returns the min-content width of the block, below which it
+	// overflows, and its max-content width, the width it takes without any
+	// line breaks.
+	Measure(ctx RenderingContext) (minWidth, maxWidth int)
+	Layout(ctx RenderingContext, c Constraints) Box
 	Margins() Margins
 }
 
+// Constraints describe the space a block is laid out in.
+type Constraints struct {
+	Width int
+
+	// Floats that the lines of the block flow around, in the coordinates
+	// of the block.  Blocks that can't flow around floats are moved below
+	// them.
+	Floats []floatArea
+}
+
+// clearFloats lays out a block that can't flow around floats below them.
+func clearFloats(c Constraints, layout func(width int) Box) Box {
+	box := layout(c.Width)
+	if clear := floatsBottom(c.Floats); clear > 0 {
+		return &StackBox{boxes: []Box{NewEmptyBox(c.Width, clear), box}}
+	}
+	return box
+}
+
+// measureInline returns the width of the widest inline box and the width of
+// all of them on one line.
+func measureInline(boxes []InlineBox, space int) (int, int) {
+	if len(boxes) == 0 {
+		return 0, 0
+	}
+	minWidth := 0
+	for _, box := range boxes {
+		bounds, _ := box.BoundsAndAdvance()
+		minWidth = maxInt(minWidth, (bounds.Max.X - minFixed(bounds.Min.X, 0)).Ceil())
+	}
+	line := &LineBox{parts: boxes, space: fixed.I(space)}
+	return minWidth, line.Bounds().Dx()
+}
+
 type Inline interface {
 	GetInlineBox(RenderingContext) InlineBox
 }
@@ -39,6 +157,8 @@ type InlineText struct {
 	text  string
 	style TextStyle
 	color color.Color
+	level int
+	link  string // the destination of the link the text is part of, if any
 }
 
 var _ Inline = (*InlineText)(nil)
@@ -52,132 +172,342 @@ func (t *InlineText) GetInlineBox(ctx RenderingContext) InlineBox {
 		Text:  t.text,
 		Face:  face,
 		Color: t.color,
+		Level: t.level,
+		link:  t.link,
+	}
+}
+
+// InlineSpans is text made of differently colored pieces, e.g. a highlighted
+// line of code.
+type InlineSpans struct {
+	spans  []*InlineText
+	source *sourceLine // for lines of code
+}
+
+var _ Inline = (*InlineSpans)(nil)
+
+func (t *InlineSpans) GetInlineBox(ctx RenderingContext) InlineBox {
+	box := &SpansBox{Spans: make([]*TextBox, len(t.spans)), source: t.source}
+	for i, span := range t.spans {
+		box.Spans[i] = span.GetInlineBox(ctx).(*TextBox)
 	}
+	return box
 }
 
 type InlineImage struct {
 	image *ebiten.Image
 	title string
 	src   string
+	level int
+	style TextStyle // of the surrounding text
+
+	// Requested size in unscaled pixels; if only one is given the other one
+	// follows the aspect ratio of the image.
+	width, height float64
+	align         VerticalAlign
+	float         Float
 }
 
 var _ Inline = (*InlineImage)(nil)
 
 func (i *InlineImage) GetInlineBox(ctx RenderingContext) InlineBox {
-	return &ImageBox{
-		image: i.image,
+	bounds := i.image.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	switch {
+	case i.width > 0 && i.height > 0:
+		w, h = i.width, i.height
+	case i.width > 0:
+		w, h = i.width, h*i.width/w
+	case i.height > 0:
+		w, h = w*i.height/h, i.height
+	}
+	box := &ImageBox{
+		image:  i.image,
+		level:  i.level,
+		width:  int(math.Round(w * ctx.Scale)),
+		height: int(math.Round(h * ctx.Scale)),
+		align:  i.align,
+	}
+	if face, err := ctx.SelectFace(i.style); err == nil {
+		box.metrics = face.Metrics()
 	}
+	return box
 }
 
 type CodeBlock struct {
-	margins Margins
-	lines   []Inline
-	space   int
+	sourcePos
+	margins    Margins
+	lines      []Inline
+	space      int
+	lineHeight LineHeight
+	decoration Decoration
+	breakout   bool
+
+	// When wrap is set, long lines are broken and the continuation lines
+	// start with wrapMarker.  Otherwise the block scrolls horizontally by
+	// scrollX pixels.
+	wrap       bool
+	wrapMarker Inline
+	scrollX    int
+
+	// Optional line numbers, drawn in a gutter that doesn't scroll, and
+	// lines drawn over highlightColor.
+	lineNumbers    []Inline
+	highlighted    []bool
+	highlightColor color.Color
 }
 
 var _ Block = (*CodeBlock)(nil)
 
-func (b *CodeBlock) GetBounds(ctx RenderingContext, width int) image.Rectangle {
-	height := 0
-	for _, line := range b.lines {
-		box := line.GetInlineBox(ctx)
+// Code is laid out as is, unless it wraps, so it can take any width.
+func (b *CodeBlock) Measure(ctx RenderingContext) (int, int) {
+	_, _, gutter := b.gutter(ctx)
+	insets := ctx.ScaleDecoration(b.decoration).insets()
+	extra := gutter + int(insets.Left+insets.Right)
+	widest, space := 0, 0
+	for _, box := range getInlineBoxes(ctx, b.lines, b.lineHeight, math.MaxInt32) {
 		bounds, _ := box.BoundsAndAdvance()
-		height += bounds.Dy()
+		widest = maxInt(widest, bounds.Max.X.Ceil())
+		space = maxInt(space, box.SpaceWidth().Ceil())
+	}
+	if b.wrap {
+		return extra + space, extra + widest
+	}
+	return extra + widest, extra + widest
+}
+
+// gutter returns the boxes of the line numbers, their width and the width of
+// the gutter, which is 0 when there are no line numbers.
+func (b *CodeBlock) gutter(ctx RenderingContext) ([]InlineBox, fixed.Int26_6, int) {
+	if b.lineNumbers == nil {
+		return nil, 0, 0
+	}
+	numbers := getInlineBoxes(ctx, b.lineNumbers, b.lineHeight, math.MaxInt32)
+	for _, box := range numbers {
+		unselectable(box)
+	}
+	var numberWidth, space fixed.Int26_6
+	for _, box := range numbers {
+		bounds, _ := box.BoundsAndAdvance()
+		numberWidth = maxFixed(numberWidth, bounds.Max.X)
+		space = maxFixed(space, box.SpaceWidth())
+	}
+	return numbers, numberWidth, (numberWidth + 2*space).Ceil()
+}
+
+func (b *CodeBlock) Layout(ctx RenderingContext, c Constraints) Box {
+	return clearFloats(c, func(width int) Box {
+		return decorate(ctx, b.decoration, width, b.layoutCode(ctx))
+	})
+}
+
+func (b *CodeBlock) layoutCode(ctx RenderingContext) func(width int) Box {
+	return func(width int) Box {
+		numbers, numberWidth, gutter := b.gutter(ctx)
+
+		var lineBoxes []Box
+		var children []ChildBox
+		contentWidth := width - gutter
+		y := 0
+		for i, box := range getInlineBoxes(ctx, b.lines, b.lineHeight, width-gutter) {
+			var rows []Box
+			if b.wrap {
+				rows = b.wrapLine(ctx, box, width-gutter)
+			} else {
+				bounds, _ := box.BoundsAndAdvance()
+				contentWidth = maxInt(contentWidth, bounds.Max.X.Ceil())
+				rows = []Box{b.newLineBox(ctx, box)}
+			}
+			height := 0
+			for _, row := range rows {
+				height += row.Bounds().Dy()
+			}
+			if b.highlighted != nil && b.highlighted[i] {
+				children = append(children, ChildBox{Box: &FillBox{image.Rect(0, 0, width, height), b.highlightColor}, Pos: image.Pt(0, y)})
+			}
+			if numbers != nil {
+				// Numbers are aligned on the right.
+				bounds, _ := numbers[i].BoundsAndAdvance()
+				x := (numberWidth - bounds.Max.X).Round()
+				children = append(children, ChildBox{Box: b.newLineBox(ctx, numbers[i]), Pos: image.Pt(x, y)})
+			}
+			lineBoxes = append(lineBoxes, rows...)
+			y += height
+		}
+		code := &ScrollBox{
+			inner:        &StackBox{boxes: lineBoxes},
+			width:        width - gutter,
+			contentWidth: contentWidth,
+			offset:       &b.scrollX,
+		}
+		if children == nil && gutter == 0 {
+			return code
+		}
+		children = append(children, ChildBox{Box: code, Pos: image.Pt(gutter, 0)})
+		return NewGroupBox(children)
+	}
+}
+
+func (b *CodeBlock) newLineBox(ctx RenderingContext, parts ...InlineBox) *LineBox {
+	return &LineBox{parts: parts, space: fixed.I(b.space), grid: ctx.gridSize()}
+}
+
+// wrapLine breaks a line of code into lines no wider than width, preferably
+// after a space.
+func (b *CodeBlock) wrapLine(ctx RenderingContext, box InlineBox, width int) []Box {
+	spans, ok := box.(*SpansBox)
+	if !ok || spans.Text() == "" {
+		return []Box{b.newLineBox(ctx, box)}
+	}
+	face, space := spans.Spans[0].Face, spans.Spans[0].SpaceWidth()
+	var marker InlineBox
+	maxWidth := fixed.I(width)
+	var lines []Box
+	runes := []rune(spans.Text())
+	for {
+		n := fitRunes(face, runes, maxWidth)
+		if n < len(runes) {
+			for i := n; i > 0; i-- {
+				if runes[i-1] == ' ' {
+					n = i
+					break
+				}
+			}
+		}
+		var piece *SpansBox
+		piece, spans = spans.Split(n)
+		if marker == nil {
+			lines = append(lines, b.newLineBox(ctx, piece))
+			marker = unselectable(b.wrapMarker.GetInlineBox(ctx))
+			setLeading(ctx, marker, b.lineHeight)
+			markerBounds, markerAdvance := marker.BoundsAndAdvance()
+			gap := maxFixed(fixed.I(b.space), maxFixed(marker.SpaceWidth(), space))
+			maxWidth -= maxFixed(markerBounds.Max.X, markerAdvance) + gap
+		} else {
+			lines = append(lines, b.newLineBox(ctx, marker, piece))
+		}
+		runes = runes[n:]
+		if len(runes) == 0 {
+			return lines
+		}
 	}
-	return image.Rect(0, 0, width, height)
 }
 
-func (b *CodeBlock) GetBox(ctx RenderingContext, width int) Box {
-	lineBoxes := make([]Box, len(b.lines))
-	for i, line := range b.lines {
-		lineBoxes[i] = &LineBox{[]InlineBox{line.GetInlineBox(ctx)}, b.space}
+// fitRunes returns how many of the runes fit in the given width, and at
+// least one.
+func fitRunes(face *Face, runes []rune, width fixed.Int26_6) int {
+	lo, hi := 1, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if face.Shape(string(runes[:mid]), false).Bounds.Max.X <= width {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
 	}
-	return &StackBox{boxes: lineBoxes}
+	return lo
 }
 
 func (b *CodeBlock) Margins() Margins {
 	return b.margins
 }
 
+func (b *CodeBlock) Breakout() bool {
+	return b.breakout
+}
+
+type Alignment int
+
+const (
+	AlignStart Alignment = iota
+	AlignCenter
+	AlignEnd
+)
+
 type TextBlock struct {
-	margins Margins
-	parts   []Inline
-	space   int
+	sourcePos
+	margins    Margins
+	parts      []Inline
+	space      int
+	level      int
+	lineHeight LineHeight
+	align      Alignment
+
+	// Headings (of level 1 to 6) aren't broken across pages and stay with
+	// the next block.  They may span all the columns of a multi-column
+	// layout.
+	headingLevel int
+	spanColumns  bool
 }
 
 var _ Block = (*TextBlock)(nil)
 
-func (b *TextBlock) GetBounds(ctx RenderingContext, width int) image.Rectangle {
-	height := 0
-	boxes := make([]InlineBox, len(b.parts))
-	for i, part := range b.parts {
-		boxes[i] = part.GetInlineBox(ctx)
-	}
-	for len(boxes) > 0 {
-		i, lineBounds := splitBoxes(boxes, width)
-		height += lineBounds.Dy()
-		boxes = boxes[i:]
-	}
-	return image.Rect(0, 0, width, height)
+func (b *TextBlock) Measure(ctx RenderingContext) (int, int) {
+	return measureInline(getInlineBoxes(ctx, b.parts, b.lineHeight, math.MaxInt32), b.space)
 }
 
-func (b *TextBlock) GetBox(ctx RenderingContext, width int) Box {
-	lines := []Box{}
-	boxes := make([]InlineBox, len(b.parts))
-	for i, part := range b.parts {
-		boxes[i] = part.GetInlineBox(ctx)
-	}
-	for len(boxes) > 0 {
-		i, _ := splitBoxes(boxes, width)
-		lines = append(lines, &LineBox{boxes[:i], b.space})
-		boxes = boxes[i:]
+func (b *TextBlock) Layout(ctx RenderingContext, c Constraints) Box {
+	boxes := getInlineBoxes(ctx, b.parts, b.lineHeight, c.Width)
+	lines := layoutLines(ctx, boxes, b.space, b.level, b.align, c.Width, c.Floats)
+	if b.headingLevel > 0 {
+		return &KeepBox{
+			Box:          &StackBox{boxes: lines},
+			withNext:     true,
+			section:      inlineText(b.parts),
+			sectionLevel: b.headingLevel,
+		}
 	}
-	return &StackBox{boxes: lines}
+	return &StackBox{boxes: lines, orphans: ctx.Orphans, widows: ctx.Widows}
 }
 
 func (b *TextBlock) Margins() Margins {
 	return b.margins
 }
 
+func (b *TextBlock) SpansColumns() bool {
+	return b.headingLevel > 0 && b.spanColumns
+}
+
+// inlineText returns the text of inline parts, separated by spaces.
+func inlineText(parts []Inline) string {
+	var words []string
+	for _, part := range parts {
+		if t, ok := part.(*InlineText); ok {
+			words = append(words, t.text)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
 type ListItemBlock struct {
-	marker  Inline
-	margins Margins
-	parts   []Inline
-	space   int
+	sourcePos
+	marker     Inline
+	margins    Margins
+	parts      []Inline
+	space      int
+	level      int
+	lineHeight LineHeight
 }
 
 var _ Block = (*ListItemBlock)(nil)
 
-func (b *ListItemBlock) GetBounds(ctx RenderingContext, width int) image.Rectangle {
-	height := 0
-	boxes := make([]InlineBox, len(b.parts))
-	for i, part := range b.parts {
-		boxes[i] = part.GetInlineBox(ctx)
-	}
-	for len(boxes) > 0 {
-		i, lineBounds := splitBoxes(boxes, width)
-		height += lineBounds.Dy()
-		boxes = boxes[i:]
-	}
-	return image.Rect(0, 0, width, height)
+// The marker is measured with the text of the item.
+func (b *ListItemBlock) Measure(ctx RenderingContext) (int, int) {
+	return measureInline(b.inlineBoxes(ctx, math.MaxInt32), b.space)
 }
 
-func (b *ListItemBlock) GetBox(ctx RenderingContext, width int) Box {
-	lines := []Box{}
-	boxes := make([]InlineBox, len(b.parts)+1)
-
-	boxes[0] = &ListItemMarkerBox{
+func (b *ListItemBlock) inlineBoxes(ctx RenderingContext, width int) []InlineBox {
+	marker := &ListItemMarkerBox{
 		Marker: b.marker.GetInlineBox(ctx),
+		Level:  b.level,
 	}
-	for i, part := range b.parts {
-		boxes[i+1] = part.GetInlineBox(ctx)
-	}
-	for len(boxes) > 0 {
-		i, _ := splitBoxes(boxes, width)
-		lines = append(lines, &LineBox{boxes[:i], b.space})
-		boxes = boxes[i:]
-	}
-	return &StackBox{boxes: lines}
+	setLeading(ctx, marker, b.lineHeight)
+	return append([]InlineBox{marker}, getInlineBoxes(ctx, b.parts, b.lineHeight, width)...)
+}
+
+func (b *ListItemBlock) Layout(ctx RenderingContext, c Constraints) Box {
+	lines := layoutLines(ctx, b.inlineBoxes(ctx, c.Width), b.space, b.level, AlignStart, c.Width, c.Floats)
+	return &StackBox{boxes: lines, orphans: ctx.Orphans, widows: ctx.Widows}
 }
 
 func (b *ListItemBlock) Margins() Margins {
@@ -185,41 +515,254 @@ func (b *ListItemBlock) Margins() Margins {
 }
 
 type StackBlock struct {
-	blocks  []Block
-	margins Margins
+	sourcePos
+	blocks     []Block
+	margins    Margins
+	decoration Decoration
+	measure    Measure
 }
 
 var _ Block = (*StackBlock)(nil)
 
-func (b *StackBlock) GetBounds(ctx RenderingContext, width int) image.Rectangle {
-	return image.Rectangle{}
+func (b *StackBlock) Measure(ctx RenderingContext) (int, int) {
+	minWidth, maxWidth := 0, 0
+	for _, block := range b.blocks {
+		margins := ctx.ScaleMargins(block.Margins())
+		extra := int(margins.Left + margins.Right)
+		blockMin, blockMax := block.Measure(ctx)
+		limit := b.measure.MaxWidth
+		if bb, ok := block.(breakoutBlock); ok && bb.Breakout() {
+			limit = b.measure.BreakoutWidth
+		}
+		blockMax, _ = b.measure.column(ctx, limit, blockMax+extra)
+		minWidth = maxInt(minWidth, blockMin+extra)
+		maxWidth = maxInt(maxWidth, blockMax)
+	}
+	insets := ctx.ScaleDecoration(b.decoration).insets()
+	extra := int(insets.Left + insets.Right)
+	return minWidth + extra, maxInt(minWidth, maxWidth) + extra
 }
 
-func (b *StackBlock) GetBox(ctx RenderingContext, width int) Box {
+// Layout lets the blocks of the stack flow around the floats.  A decorated
+// stack is moved below them instead.
+func (b *StackBlock) Layout(ctx RenderingContext, c Constraints) Box {
+	if b.decoration.IsZero() {
+		return b.getStackBox(ctx, c.Width, c.Floats)
+	}
+	return clearFloats(c, func(width int) Box {
+		return decorate(ctx, b.decoration, width, func(width int) Box {
+			return b.getStackBox(ctx, width, nil)
+		})
+	})
+}
+
+func (b *StackBlock) getStackBox(ctx RenderingContext, width int, floats []floatArea) Box {
 	boxes := make([]Box, 0, len(b.blocks))
-	bottomMargin := 0
-	for i, block := range b.blocks {
+	y := 0
+	ownFloats := false
+	placed := false
+	bottomMargin := 0.0
+	// Scaled margins are generally fractional.  The rounding error is
+	// carried over to the next gap so that it doesn't build up down the page.
+	carry := 0.0
+	for _, block := range b.blocks {
 		margins := ctx.ScaleMargins(block.Margins())
-		if i > 0 {
-			gap := maxInt(bottomMargin, int(margins.Top))
+		maxWidth := b.measure.MaxWidth
+		if bb, ok := block.(breakoutBlock); ok && bb.Breakout() {
+			maxWidth = b.measure.BreakoutWidth
+		}
+		colWidth, colLeft := b.measure.column(ctx, maxWidth, width)
+
+		// Floats don't take up space in the stack; they are drawn over it,
+		// aligned with the top of the next block.
+		if f, ok := block.(*FloatBlock); ok {
+			box, pos, area := f.place(ctx, colLeft, colWidth, y+int(bottomMargin), floats)
+			boxes = append(boxes, &OverlayBox{inner: box, pos: pos.Sub(image.Pt(0, y))})
+			floats = append(floats, area)
+			ownFloats = true
+			continue
+		}
+
+		if placed {
+			exactGap := math.Max(bottomMargin, margins.Top) + carry
+			gap := int(math.Round(exactGap))
+			carry = exactGap - float64(gap)
+			if grid := ctx.gridSize(); grid > 0 {
+				gap = roundUp(gap, grid)
+				carry = 0
+			}
 			if gap > 0 {
 				boxes = append(boxes, NewEmptyBox(width, gap))
+				y += gap
 			}
 		}
-		if margins.Left > 0 || margins.Right > 0 {
-			box := block.GetBox(ctx, width-int(margins.Left+margins.Right))
-			boxes = append(boxes, NewContainerBox(box, width, box.Bounds().Dy(), int(margins.Left), 0))
-		} else {
-			boxes = append(boxes, block.GetBox(ctx, width))
+		placed = true
+
+		left := colLeft + int(margins.Left)
+		blockWidth := colWidth - int(margins.Left+margins.Right)
+		box := block.Layout(ctx, Constraints{
+			Width:  blockWidth,
+			Floats: translateFloats(floats, image.Pt(-left, -y)),
+		})
+		if left > 0 || margins.Right > 0 {
+			box = NewContainerBox(box, width, box.Bounds().Dy(), left, 0)
+		}
+		if s, ok := block.(sourceLined); ok && s.SourceLine() > 0 {
+			box = &AnchorBox{Box: box, line: s.SourceLine()}
+		}
+		boxes = append(boxes, box)
+		y += box.Bounds().Max.Y
+		bottomMargin = margins.Bottom
+	}
+	// The stack is at least as high as its own floats.
+	if ownFloats {
+		if clear := floatsBottom(floats) - y; clear > 0 {
+			boxes = append(boxes, NewEmptyBox(width, clear))
 		}
-		bottomMargin = int(margins.Bottom)
 	}
 	return &StackBox{boxes: boxes}
 }
 
+// The margins of the first and last blocks collapse with those of the stack,
+// unless it is decorated.
 func (b *StackBlock) Margins() Margins {
+	if !b.decoration.IsZero() || len(b.blocks) == 0 {
+		return b.margins
+	}
 	return Margins{
 		Top:    math.Max(b.blocks[0].Margins().Top, b.margins.Top),
 		Bottom: math.Max(b.blocks[len(b.blocks)-1].Margins().Bottom, b.margins.Bottom),
+		Left:   b.margins.Left,
+		Right:  b.margins.Right,
+	}
+}
+
+// decorate lays out content inside the padding and border of a decoration and
+// returns a box that draws them behind it.
+func decorate(ctx RenderingContext, d Decoration, width int, layout func(width int) Box) Box {
+	if d.IsZero() {
+		return layout(width)
+	}
+	d = ctx.ScaleDecoration(d)
+	insets := d.insets()
+	left, right := int(insets.Left), int(insets.Right)
+	top, bottom := int(insets.Top), int(insets.Bottom)
+	inner := layout(width - left - right)
+	box := NewContainerBox(inner, width, top+inner.Bounds().Dy()+bottom, left, top)
+	box.decoration = d
+	return box
+}
+
+// layoutLines breaks inline boxes into lines.  Lines are shortened where they
+// run alongside floats.
+func layoutLines(ctx RenderingContext, boxes []InlineBox, space, level int, align Alignment, width int, floats []floatArea) []Box {
+	lines := []Box{}
+	y := 0
+	for len(boxes) > 0 {
+		var i, left, right int
+		var line Box
+		// The span depends on the height of the line, which depends on the
+		// boxes that fit in the span.  One refinement is enough in practice.
+		height := 1
+		for attempt := 0; attempt < 2; attempt++ {
+			left, right = lineSpan(floats, y, y+height, width)
+			i, _ = splitBoxes(boxes, right-left)
+			line = newLineBox(ctx, boxes[:i], space, level, align, right-left)
+			if h := line.Bounds().Dy(); h != height {
+				height = h
+			} else {
+				break
+			}
+		}
+		if left > 0 || right < width {
+			line = NewContainerBox(line, width, line.Bounds().Dy(), left, 0)
+		}
+		lines = append(lines, line)
+		y += line.Bounds().Dy()
+		boxes = boxes[i:]
+	}
+	return lines
+}
+
+// newLineBox makes a line out of boxes in logical order.  Lines of right to
+// left paragraphs are reordered for display, and their start is on the right.
+func newLineBox(ctx RenderingContext, boxes []InlineBox, space int, level int, align Alignment, width int) Box {
+	line := &LineBox{parts: reorderBoxes(boxes, level), space: fixed.I(space), grid: ctx.gridSize()}
+	if level%2 == 1 {
+		switch align {
+		case AlignStart:
+			align = AlignEnd
+		case AlignEnd:
+			align = AlignStart
+		}
+	}
+	bounds := line.Bounds()
+	switch align {
+	case AlignCenter:
+		return NewContainerBox(line, width, bounds.Dy(), (width-bounds.Dx())/2, 0)
+	case AlignEnd:
+		return NewContainerBox(line, width, bounds.Dy(), width-bounds.Dx(), 0)
+	}
+	return line
+}
+
+// A RuleBlock is a horizontal line across the column, for a thematic break.
+type RuleBlock struct {
+	sourcePos
+	margins Margins
+	color   color.Color
+}
+
+var _ Block = (*RuleBlock)(nil)
+
+func (b *RuleBlock) Measure(ctx RenderingContext) (int, int) {
+	return 0, 0
+}
+
+func (b *RuleBlock) Layout(ctx RenderingContext, c Constraints) Box {
+	thickness := maxInt(1, int(math.Round(ctx.Scale)))
+	return &FillBox{image.Rect(0, 0, c.Width, thickness), b.color}
+}
+
+func (b *RuleBlock) Margins() Margins {
+	return b.margins
+}
+
+// A FigureBlock is an image on its own, centered, with an optional caption
+// underneath.
+type FigureBlock struct {
+	sourcePos
+	margins    Margins
+	image      *InlineImage
+	caption    Block
+	captionGap float64
+}
+
+var _ Block = (*FigureBlock)(nil)
+
+// The image scales down to fit, so only the caption has a minimum width.
+func (b *FigureBlock) Measure(ctx RenderingContext) (int, int) {
+	_, imgWidth := measureInline([]InlineBox{b.image.GetInlineBox(ctx)}, 0)
+	if b.caption == nil {
+		return 0, imgWidth
 	}
+	minWidth, maxWidth := b.caption.Measure(ctx)
+	return minWidth, maxInt(imgWidth, maxWidth)
+}
+
+func (b *FigureBlock) Layout(ctx RenderingContext, c Constraints) Box {
+	return clearFloats(c, func(width int) Box {
+		img := b.image.GetInlineBox(ctx)
+		img.(widthFitter).FitWidth(width)
+		boxes := []Box{newLineBox(ctx, []InlineBox{img}, 0, 0, AlignCenter, width)}
+		if b.caption != nil {
+			gap := int(b.captionGap * ctx.Scale)
+			boxes = append(boxes, NewEmptyBox(width, gap), b.caption.Layout(ctx, Constraints{Width: width}))
+		}
+		return &KeepBox{Box: &StackBox{boxes: boxes}}
+	})
+}
+
+func (b *FigureBlock) Margins() Margins {
+	return b.margins
 }
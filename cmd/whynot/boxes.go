@@ -3,11 +3,13 @@ package main
 import (
 	"image"
 	"image/color"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/text"
 	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
 )
 
 type Box interface {
@@ -15,137 +17,567 @@ type Box interface {
 	Draw(dst *ebiten.Image, x, y int)
 }
 
+// Boxes that contain other boxes implement this, so that the box tree can be
+// searched, e.g. for the box under the mouse.
+type ParentBox interface {
+	Children() []ChildBox
+}
+
+// A ChildBox is a box with its position relative to its parent.
+type ChildBox struct {
+	Box
+	Pos image.Point
+}
+
+// Boxes that can be broken between lines, across columns or pages, implement
+// this.
+type SplittableBox interface {
+	Box
+	// SplitAt splits the box so that the first part is at most height
+	// high.  The first part is nil if nothing fits.
+	SplitAt(height int) (Box, Box)
+}
+
+// splitBox splits a box so that the first part is at most height high, if
+// it can be split.  The first part is nil if nothing fits and the second
+// one is nil if everything does.
+func splitBox(box Box, height int) (Box, Box) {
+	if box.Bounds().Max.Y <= height {
+		return box, nil
+	}
+	if s, ok := box.(SplittableBox); ok {
+		return s.SplitAt(height)
+	}
+	return nil, box
+}
+
+// boxPath returns the boxes that contain p, from box down to the innermost
+// one, with their positions.
+func boxPath(box Box, p image.Point) []ChildBox {
+	var path []ChildBox
+	child := ChildBox{Box: box}
+	for {
+		path = append(path, child)
+		parent, ok := child.Box.(ParentBox)
+		if !ok {
+			return path
+		}
+		found := false
+		children := parent.Children()
+		// Later children are drawn over earlier ones.
+		for i := len(children) - 1; i >= 0; i-- {
+			c := children[i]
+			c.Pos = c.Pos.Add(child.Pos)
+			if p.In(c.Bounds().Add(c.Pos)) {
+				child, found = c, true
+				break
+			}
+		}
+		if !found {
+			return path
+		}
+	}
+}
+
+// Inline boxes are positioned along the line in 26.6 fixed point so that
+// fractional advances don't accumulate rounding errors across a line.
 type InlineBox interface {
-	BoundsAndAdvance() (image.Rectangle, int)
-	SpaceWidth() int
-	DrawInline(dst *ebiten.Image, x, y int) int
+	BoundsAndAdvance() (fixed.Rectangle26_6, fixed.Int26_6)
+	SpaceWidth() fixed.Int26_6
+	DrawInline(dst *ebiten.Image, x, y fixed.Int26_6) fixed.Int26_6
 }
 
 type TextBox struct {
-	Text  string
-	Face  font.Face
-	Color color.Color
+	Text    string
+	Face    *Face
+	Color   color.Color
+	Level   int
+	Leading fixed.Int26_6 // added above and below the text
+	run     *GlyphRun
+	carets  []fixed.Int26_6
+
+	// Ranges of runes drawn over a color, such as the selection, in the
+	// order they are drawn.  Text that isn't part of the document, such as
+	// line numbers, can't be selected.
+	marks    []textMark
+	noSelect bool
+
+	link string
+}
+
+// A textMark is a range of runes of a box drawn over a color.
+type textMark struct {
+	start, end int
+	color      color.Color
 }
 
 var _ InlineBox = (*TextBox)(nil)
 
-func (b *TextBox) BoundsAndAdvance() (image.Rectangle, int) {
-	bounds, advance := font.BoundString(b.Face, b.Text)
+func (b *TextBox) BidiLevel() int {
+	return b.Level
+}
+
+func (b *TextBox) glyphs() *GlyphRun {
+	if b.run == nil {
+		b.run = b.Face.Shape(b.Text, b.Level%2 == 1)
+	}
+	return b.run
+}
+
+func (b *TextBox) BoundsAndAdvance() (fixed.Rectangle26_6, fixed.Int26_6) {
+	run := b.glyphs()
 	metrics := b.Face.Metrics()
-	return image.Rect(
-		bounds.Min.X.Floor(),
-		-metrics.Ascent.Ceil(),
-		bounds.Max.X.Ceil(),
-		metrics.Descent.Ceil(),
-	), advance.Ceil()
+	return fixed.Rectangle26_6{
+		Min: fixed.Point26_6{X: run.Bounds.Min.X, Y: -metrics.Ascent - b.Leading},
+		Max: fixed.Point26_6{X: run.Bounds.Max.X, Y: metrics.Descent + b.Leading},
+	}, run.Advance
 }
 
-func (b *TextBox) SpaceWidth() int {
+func (b *TextBox) SpaceWidth() fixed.Int26_6 {
 	adv, _ := b.Face.GlyphAdvance(' ')
-	return adv.Ceil()
+	return adv
 }
 
-func (b *TextBox) DrawInline(dst *ebiten.Image, x, y int) int {
+func (b *TextBox) DrawInline(dst *ebiten.Image, x, y fixed.Int26_6) fixed.Int26_6 {
 	bounds, advance := b.BoundsAndAdvance()
-	// drawRect(dst, bounds.Add(image.Pt(x, y)), color.Gray{Y: 128})
-	_ = bounds
-	text.Draw(dst, b.Text, b.Face, x, y, b.Color)
+	for _, m := range b.marks {
+		x0, x1 := b.runeX(m.start), b.runeX(m.end)
+		if x1 < x0 {
+			x0, x1 = x1, x0
+		}
+		rect := image.Rect((x + x0).Round(), (y + bounds.Min.Y).Round(), (x + x1).Round(), (y + bounds.Max.Y).Round())
+		(&FillBox{rect, m.color}).Draw(dst, 0, 0)
+	}
+	b.glyphs().Draw(dst, b.Face, x, y, b.Color)
 	return x + advance
 }
 
+// runeX returns the position of the boundary before the nth rune, from the
+// left of the box.  In right to left text, runes start from the right.
+func (b *TextBox) runeX(n int) fixed.Int26_6 {
+	if b.Level%2 == 1 {
+		return b.glyphs().Advance - b.logicalX(n)
+	}
+	return b.logicalX(n)
+}
+
+// logicalX returns the advance of the first n runes.
+func (b *TextBox) logicalX(n int) fixed.Int26_6 {
+	if b.carets == nil {
+		b.carets = b.glyphs().Carets(utf8.RuneCountInString(b.Text), b.Level%2 == 1)
+	}
+	return b.carets[clampInt(n, 0, len(b.carets)-1)]
+}
+
+func (b *TextBox) selectableText() string {
+	return b.Text
+}
+
+func (b *TextBox) copyText(start, end int) string {
+	runes := []rune(b.Text)
+	return string(runes[clampInt(start, 0, len(runes)):clampInt(end, 0, len(runes))])
+}
+
+// hitTest returns the rune boundary nearest to x.
+func (b *TextBox) hitTest(x fixed.Int26_6) int {
+	n := len([]rune(b.Text))
+	if b.Level%2 == 1 {
+		x = b.glyphs().Advance - x
+	}
+	// Boundaries are in order of increasing advance in logical order.
+	lo, hi := 0, n
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if b.logicalX(mid) < x {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo > 0 && x-b.logicalX(lo-1) < b.logicalX(lo)-x {
+		return lo - 1
+	}
+	return lo
+}
+
+func (b *TextBox) mark(start, end int, clr color.Color) {
+	if end > start {
+		b.marks = append(b.marks, textMark{start, end, clr})
+	}
+}
+
+func (b *TextBox) clearMarks() {
+	b.marks = nil
+}
+
+func (b *TextBox) textMarks() []textMark {
+	return b.marks
+}
+
+// A SpansBox sets differently styled pieces of text next to each other,
+// without spaces in between.
+type SpansBox struct {
+	Spans []*TextBox
+
+	// The line of code the spans are set from, as written, and the offset
+	// of the spans in it, in runes, if the line is wrapped.
+	source *sourceLine
+	start  int
+}
+
+var _ InlineBox = (*SpansBox)(nil)
+
+func (b *SpansBox) BoundsAndAdvance() (fixed.Rectangle26_6, fixed.Int26_6) {
+	var bounds fixed.Rectangle26_6
+	var advance fixed.Int26_6
+	for i, span := range b.Spans {
+		spanBounds, spanAdvance := span.BoundsAndAdvance()
+		spanBounds = spanBounds.Add(fixed.Point26_6{X: advance})
+		if i == 0 {
+			bounds = spanBounds
+		} else {
+			// Not Union, which ignores the height of spans without ink.
+			bounds.Min.X = minFixed(bounds.Min.X, spanBounds.Min.X)
+			bounds.Min.Y = minFixed(bounds.Min.Y, spanBounds.Min.Y)
+			bounds.Max.X = maxFixed(bounds.Max.X, spanBounds.Max.X)
+			bounds.Max.Y = maxFixed(bounds.Max.Y, spanBounds.Max.Y)
+		}
+		advance += spanAdvance
+	}
+	return bounds, advance
+}
+
+func (b *SpansBox) SpaceWidth() fixed.Int26_6 {
+	if len(b.Spans) == 0 {
+		return 0
+	}
+	return b.Spans[0].SpaceWidth()
+}
+
+func (b *SpansBox) DrawInline(dst *ebiten.Image, x, y fixed.Int26_6) fixed.Int26_6 {
+	for _, span := range b.Spans {
+		x = span.DrawInline(dst, x, y)
+	}
+	return x
+}
+
+func (b *SpansBox) selectableText() string {
+	return b.Text()
+}
+
+// copyText returns the text between two offsets as written: tabs that were
+// expanded are copied as tabs.
+func (b *SpansBox) copyText(start, end int) string {
+	if b.source == nil {
+		runes := []rune(b.Text())
+		return string(runes[clampInt(start, 0, len(runes)):clampInt(end, 0, len(runes))])
+	}
+	return b.source.slice(b.start+start, b.start+end)
+}
+
+func (b *SpansBox) hitTest(x fixed.Int26_6) int {
+	offset := 0
+	for i, span := range b.Spans {
+		_, advance := span.BoundsAndAdvance()
+		n := len([]rune(span.Text))
+		if x < advance || i == len(b.Spans)-1 {
+			return offset + span.hitTest(x)
+		}
+		x -= advance
+		offset += n
+	}
+	return offset
+}
+
+func (b *SpansBox) mark(start, end int, clr color.Color) {
+	offset := 0
+	for _, span := range b.Spans {
+		n := len([]rune(span.Text))
+		span.mark(clampInt(start-offset, 0, n), clampInt(end-offset, 0, n), clr)
+		offset += n
+	}
+}
+
+func (b *SpansBox) clearMarks() {
+	for _, span := range b.Spans {
+		span.clearMarks()
+	}
+}
+
+// textMarks returns the marks of the spans, which are split where the spans
+// meet.
+func (b *SpansBox) textMarks() []textMark {
+	var marks []textMark
+	offset := 0
+	for _, span := range b.Spans {
+		for _, m := range span.marks {
+			marks = append(marks, textMark{m.start + offset, m.end + offset, m.color})
+		}
+		offset += len([]rune(span.Text))
+	}
+	return marks
+}
+
+// Text returns the text of all the spans.
+func (b *SpansBox) Text() string {
+	var sb strings.Builder
+	for _, span := range b.Spans {
+		sb.WriteString(span.Text)
+	}
+	return sb.String()
+}
+
+// Split returns the first n runes of the spans and the rest.
+func (b *SpansBox) Split(n int) (*SpansBox, *SpansBox) {
+	head := &SpansBox{source: b.source, start: b.start}
+	tail := &SpansBox{source: b.source, start: b.start + n}
+	for _, span := range b.Spans {
+		runes := []rune(span.Text)
+		if k := len(runes); n >= k {
+			head.Spans = append(head.Spans, span)
+			n -= k
+			continue
+		}
+		if n > 0 {
+			h := *span
+			h.Text, h.run, h.carets = string(runes[:n]), nil, nil
+			head.Spans = append(head.Spans, &h)
+		}
+		t := *span
+		t.Text, t.run, t.carets = string(runes[n:]), nil, nil
+		tail.Spans = append(tail.Spans, &t)
+		n = 0
+	}
+	return head, tail
+}
+
 type ListItemMarkerBox struct {
 	Marker InlineBox
+	Level  int
 }
 
 var _ InlineBox = (*ListItemMarkerBox)(nil)
 
-func (b *ListItemMarkerBox) BoundsAndAdvance() (image.Rectangle, int) {
+func (b *ListItemMarkerBox) BoundsAndAdvance() (fixed.Rectangle26_6, fixed.Int26_6) {
 	bounds, _ := b.Marker.BoundsAndAdvance()
-	return image.Rect(0, bounds.Min.Y, 0, bounds.Max.Y), 0
+	bounds.Min.X, bounds.Max.X = 0, 0
+	return bounds, 0
 }
 
-func (b *ListItemMarkerBox) SpaceWidth() int {
+func (b *ListItemMarkerBox) SpaceWidth() fixed.Int26_6 {
 	return b.Marker.SpaceWidth()
 }
 
-func (b *ListItemMarkerBox) DrawInline(dst *ebiten.Image, x, y int) int {
+func (b *ListItemMarkerBox) BidiLevel() int {
+	return b.Level
+}
+
+// In a right to left paragraph the marker is the last box of the line, so it
+// hangs in the right margin instead.
+func (b *ListItemMarkerBox) DrawInline(dst *ebiten.Image, x, y fixed.Int26_6) fixed.Int26_6 {
 	_, advance := b.Marker.BoundsAndAdvance()
 	space := b.Marker.SpaceWidth()
+	if b.Level%2 == 1 {
+		b.Marker.DrawInline(dst, x, y)
+		return x
+	}
 	b.Marker.DrawInline(dst, x-advance-space, y)
 	return x - space
 }
 
+type VerticalAlign int
+
+const (
+	AlignBaseline VerticalAlign = iota
+	AlignMiddle
+	AlignTop
+)
+
+// An ImageBox draws an image scaled to width x height pixels.  Its vertical
+// position relative to the baseline depends on the alignment and on the
+// metrics of the surrounding text.
 type ImageBox struct {
-	image *ebiten.Image
+	image         *ebiten.Image
+	level         int
+	width, height int
+	align         VerticalAlign
+	metrics       font.Metrics
 }
 
 var _ InlineBox = (*ImageBox)(nil)
 
-func (b *ImageBox) BoundsAndAdvance() (image.Rectangle, int) {
-	bounds := b.image.Bounds()
-	return bounds, bounds.Dx()
+func (b *ImageBox) BidiLevel() int {
+	return b.level
+}
+
+// FitWidth scales the image down, keeping its aspect ratio, so that it is
+// no wider than maxWidth.
+func (b *ImageBox) FitWidth(maxWidth int) {
+	if b.width <= maxWidth || b.width <= 0 {
+		return
+	}
+	b.height = b.height * maxWidth / b.width
+	b.width = maxWidth
+}
+
+func (b *ImageBox) BoundsAndAdvance() (fixed.Rectangle26_6, fixed.Int26_6) {
+	h := fixed.I(b.height)
+	var top fixed.Int26_6
+	switch b.align {
+	case AlignMiddle:
+		top = -b.metrics.XHeight/2 - h/2
+	case AlignTop:
+		top = -b.metrics.Ascent
+	default:
+		top = -h
+	}
+	return fixed.Rectangle26_6{
+		Min: fixed.Point26_6{Y: top},
+		Max: fixed.Point26_6{X: fixed.I(b.width), Y: top + h},
+	}, fixed.I(b.width)
 }
 
-func (b *ImageBox) SpaceWidth() int {
+func (b *ImageBox) SpaceWidth() fixed.Int26_6 {
 	return 0
 }
 
-func (b *ImageBox) DrawInline(dst *ebiten.Image, x, y int) int {
-	geoM := ebiten.GeoM{}
-	geoM.Translate(float64(x), float64(y))
-	dst.DrawImage(b.image, &ebiten.DrawImageOptions{GeoM: geoM})
-	return b.image.Bounds().Dx()
+func (b *ImageBox) DrawInline(dst *ebiten.Image, x, y fixed.Int26_6) fixed.Int26_6 {
+	bounds, advance := b.BoundsAndAdvance()
+	imgBounds := b.image.Bounds()
+	op := &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear}
+	op.GeoM.Scale(
+		float64(b.width)/float64(imgBounds.Dx()),
+		float64(b.height)/float64(imgBounds.Dy()),
+	)
+	op.GeoM.Translate(float64(x.Round()), float64((y + bounds.Min.Y).Round()))
+	dst.DrawImage(b.image, op)
+	return x + advance
 }
 
+// A LineBox lays out inline boxes along a baseline.  Positions within the line
+// are kept in fixed point; the line itself occupies whole pixels.
 type LineBox struct {
 	parts []InlineBox
-	space int
+	space fixed.Int26_6
+	grid  int // if not 0, the height of the line is a multiple of this
 }
 
 var _ Box = (*LineBox)(nil)
 
-func (b *LineBox) BoundsAndAdvance() (image.Rectangle, int) {
+// gap returns the space between two consecutive boxes of the line.
+func (b *LineBox) gap(prevSpace, space fixed.Int26_6) fixed.Int26_6 {
+	return maxFixed(b.space, maxFixed(prevSpace, space))
+}
+
+func (b *LineBox) BoundsAndAdvance() (fixed.Rectangle26_6, fixed.Int26_6) {
 	bounds, advance := b.parts[0].BoundsAndAdvance()
 	left := bounds.Min.X
 	if left < 0 {
-		bounds = bounds.Add(image.Pt(-left, 0))
+		bounds = bounds.Add(fixed.Point26_6{X: -left})
 		advance -= left
 	}
+	prevSpace := b.parts[0].SpaceWidth()
 	for _, box := range b.parts[1:] {
-		advance += b.space
+		space := box.SpaceWidth()
+		advance += b.gap(prevSpace, space)
+		prevSpace = space
 		boxBounds, boxAdvance := box.BoundsAndAdvance()
-		bounds = bounds.Union(boxBounds.Add(image.Pt(advance, 0)))
+		bounds = bounds.Union(boxBounds.Add(fixed.Point26_6{X: advance}))
 		advance += boxAdvance
 	}
 	return bounds, advance
 }
 
+// verticalLayout returns the height of the line and the position of its
+// baseline, in whole pixels.
+func (b *LineBox) verticalLayout(bounds fixed.Rectangle26_6) (height, baseline int) {
+	height = (bounds.Max.Y - bounds.Min.Y).Ceil()
+	baseline = (-bounds.Min.Y).Ceil()
+	if b.grid > 0 {
+		gridHeight := roundUp(height, b.grid)
+		baseline += (gridHeight - height) / 2
+		height = gridHeight
+	}
+	return height, baseline
+}
+
 func (b *LineBox) Bounds() image.Rectangle {
 	bounds, _ := b.BoundsAndAdvance()
-	return bounds.Sub(bounds.Min)
+	height, _ := b.verticalLayout(bounds)
+	return image.Rect(0, 0, (bounds.Max.X - bounds.Min.X).Ceil(), height)
 }
 
-func (b *LineBox) Draw(dst *ebiten.Image, x, y int) {
+// partPositions returns where the parts of the line are drawn, relative to
+// the line, and the position of its baseline.
+func (b *LineBox) partPositions() ([]fixed.Int26_6, int) {
 	lineBounds, _ := b.BoundsAndAdvance()
-	y -= lineBounds.Min.Y
+	_, baseline := b.verticalLayout(lineBounds)
+	xs := make([]fixed.Int26_6, len(b.parts))
+	var x, prevSpace fixed.Int26_6
+	for i, box := range b.parts {
+		bounds, advance := box.BoundsAndAdvance()
+		space := box.SpaceWidth()
+		if i == 0 {
+			x = -minFixed(bounds.Min.X, 0)
+		} else {
+			x += b.gap(prevSpace, space)
+		}
+		xs[i] = x
+		// A marker at the start of a line hangs in the margin, see
+		// ListItemMarkerBox.DrawInline.
+		if m, ok := box.(*ListItemMarkerBox); ok && m.Level%2 == 0 {
+			advance = -m.Marker.SpaceWidth()
+		}
+		x += advance
+		prevSpace = space
+	}
+	return xs, baseline
+}
 
-	bounds, _ := b.parts[0].BoundsAndAdvance()
-	left := bounds.Min.X
-	if left < 0 {
-		x -= left
+func (b *LineBox) Draw(dst *ebiten.Image, x, y int) {
+	xs, baseline := b.partPositions()
+	fx := fixed.I(x)
+	fy := fixed.I(y + baseline)
+	for i, box := range b.parts {
+		if i > 0 {
+			b.drawMarkedGap(dst, b.parts[i-1], box, fx+xs[i-1], fx+xs[i], fy)
+		}
+		box.DrawInline(dst, fx+xs[i], fy)
 	}
-	prevSpace := b.parts[0].SpaceWidth()
+}
 
-	x = b.parts[0].DrawInline(dst, x, y)
-	for _, box := range b.parts[1:] {
-		space := box.SpaceWidth()
-		x = box.DrawInline(dst, x+maxInt(prevSpace, space), y)
-		prevSpace = space
+// drawMarkedGap fills the gap between two boxes when a mark runs from one to
+// the other.
+func (b *LineBox) drawMarkedGap(dst *ebiten.Image, prev, next InlineBox, prevX, nextX, y fixed.Int26_6) {
+	p, ok1 := prev.(selectableBox)
+	n, ok2 := next.(selectableBox)
+	if !ok1 || !ok2 {
+		return
+	}
+	length := len([]rune(p.selectableText()))
+	for _, pm := range p.textMarks() {
+		if pm.end < length {
+			continue
+		}
+		for _, nm := range n.textMarks() {
+			if nm.start > 0 || nm.color != pm.color {
+				continue
+			}
+			pBounds, pAdvance := prev.BoundsAndAdvance()
+			nBounds, _ := next.BoundsAndAdvance()
+			top, bottom := minFixed(pBounds.Min.Y, nBounds.Min.Y), maxFixed(pBounds.Max.Y, nBounds.Max.Y)
+			rect := image.Rect((prevX + pAdvance).Round(), (y + top).Round(), nextX.Round(), (y + bottom).Round())
+			(&FillBox{rect, pm.color}).Draw(dst, 0, 0)
+		}
 	}
 }
 
 type StackBox struct {
 	boxes []Box
+
+	// For stacks of lines, the minimum number of lines to leave on either
+	// side of a break.
+	orphans, widows int
 }
 
 func (b *StackBox) Bounds() image.Rectangle {
@@ -163,14 +595,86 @@ func (b *StackBox) Draw(dst *ebiten.Image, x, y int) {
 	}
 }
 
+// SplitAt breaks the stack between its boxes, or inside the box that
+// straddles the limit if it can be split.  Gaps between blocks are dropped
+// at the break, boxes that keep with the next one are moved after it, and
+// stacks of lines leave at least orphans lines before the break and widows
+// lines after it.
+func (b *StackBox) SplitAt(height int) (Box, Box) {
+	y := 0
+	for i, box := range b.boxes {
+		h := box.Bounds().Max.Y
+		if y+h <= height {
+			y += h
+			continue
+		}
+		if b.orphans > 0 || b.widows > 0 {
+			if len(b.boxes)-i < b.widows {
+				i = maxInt(0, len(b.boxes)-b.widows)
+			}
+			if i == 0 || i < b.orphans {
+				return nil, b
+			}
+			return b.split(b.boxes[:i:i], b.boxes[i:])
+		}
+		head := b.boxes[:i:i]
+		tail := b.boxes[i+1:]
+		first, rest := splitBox(box, height-y)
+		if first != nil {
+			head = append(head, first)
+		}
+		if rest != nil {
+			tail = append([]Box{rest}, tail...)
+		}
+		for len(head) > 0 && len(tail) > 0 {
+			last := head[len(head)-1]
+			if _, ok := last.(*EmptyBox); !ok && !keepsWithNext(last) {
+				break
+			}
+			head = head[:len(head)-1]
+			tail = append([]Box{last}, tail...)
+		}
+		return b.split(head, tail)
+	}
+	return b, nil
+}
+
+func (b *StackBox) split(head, tail []Box) (Box, Box) {
+	for len(tail) > 0 {
+		if _, ok := tail[0].(*EmptyBox); !ok {
+			break
+		}
+		tail = tail[1:]
+	}
+	switch {
+	case len(head) == 0:
+		return nil, b
+	case len(tail) == 0:
+		return &StackBox{boxes: head}, nil
+	}
+	return &StackBox{boxes: head, orphans: b.orphans, widows: b.widows},
+		&StackBox{boxes: tail, orphans: b.orphans, widows: b.widows}
+}
+
+func (b *StackBox) Children() []ChildBox {
+	children := make([]ChildBox, len(b.boxes))
+	y := 0
+	for i, box := range b.boxes {
+		children[i] = ChildBox{Box: box, Pos: image.Pt(0, y)}
+		y += box.Bounds().Max.Y
+	}
+	return children
+}
+
 func splitBoxes(boxes []InlineBox, width int) (int, image.Rectangle) {
 	if len(boxes) == 0 {
 		return 0, image.Rectangle{}
 	}
+	maxX := fixed.I(width)
 	bounds, advance := boxes[0].BoundsAndAdvance()
 	left := bounds.Min.X
 	if left < 0 {
-		bounds = bounds.Add(image.Pt(-left, 0))
+		bounds = bounds.Add(fixed.Point26_6{X: -left})
 		advance -= left
 	}
 	prevSpace := boxes[0].SpaceWidth()
@@ -178,17 +682,22 @@ func splitBoxes(boxes []InlineBox, width int) (int, image.Rectangle) {
 		boxBounds, boxAdvance := box.BoundsAndAdvance()
 
 		space := box.SpaceWidth()
-		advance += maxInt(space, prevSpace)
+		advance += maxFixed(space, prevSpace)
 		prevSpace = space
 
-		movedBoxBounds := boxBounds.Add(image.Pt(advance, 0))
-		bounds = bounds.Union(movedBoxBounds)
-		if bounds.Max.X > width {
-			return i + 1, bounds
+		movedBoxBounds := boxBounds.Add(fixed.Point26_6{X: advance})
+		if bounds.Union(movedBoxBounds).Max.X > maxX {
+			return i + 1, pixelBounds(bounds)
 		}
+		bounds = bounds.Union(movedBoxBounds)
 		advance += boxAdvance
 	}
-	return len(boxes), bounds
+	return len(boxes), pixelBounds(bounds)
+}
+
+// pixelBounds returns the smallest rectangle of whole pixels containing r.
+func pixelBounds(r fixed.Rectangle26_6) image.Rectangle {
+	return image.Rect(r.Min.X.Floor(), r.Min.Y.Floor(), r.Max.X.Ceil(), r.Max.Y.Ceil())
 }
 
 type EmptyBox struct {
@@ -209,9 +718,10 @@ func (b *EmptyBox) Draw(dst *ebiten.Image, x, y int) {
 }
 
 type ContainerBox struct {
-	bounds   image.Rectangle
-	innerPos image.Point
-	inner    Box
+	bounds     image.Rectangle
+	innerPos   image.Point
+	inner      Box
+	decoration Decoration // scaled
 }
 
 func NewContainerBox(inner Box, w, h, x, y int) *ContainerBox {
@@ -227,9 +737,204 @@ func (b *ContainerBox) Bounds() image.Rectangle {
 }
 
 func (b *ContainerBox) Draw(dst *ebiten.Image, x, y int) {
+	if !b.decoration.IsZero() {
+		b.decoration.draw(dst, b.bounds.Add(image.Pt(x, y)))
+	}
 	b.inner.Draw(dst, x+b.innerPos.X, y+b.innerPos.Y)
 }
 
+// SplitAt splits the inner box.  Both parts keep the padding and decoration
+// of the container.
+func (b *ContainerBox) SplitAt(height int) (Box, Box) {
+	bottom := b.bounds.Dy() - b.innerPos.Y - b.inner.Bounds().Dy()
+	first, rest := splitBox(b.inner, height-b.innerPos.Y-bottom)
+	switch {
+	case first == nil:
+		return nil, b
+	case rest == nil:
+		return b, nil
+	}
+	part := func(inner Box) Box {
+		c := *b
+		c.inner = inner
+		c.bounds.Max.Y = c.bounds.Min.Y + b.innerPos.Y + inner.Bounds().Dy() + bottom
+		return &c
+	}
+	return part(first), part(rest)
+}
+
+func (b *ContainerBox) Children() []ChildBox {
+	return []ChildBox{{Box: b.inner, Pos: b.innerPos}}
+}
+
+// A KeepBox is a box that isn't broken across columns or pages, such as a
+// heading or a figure.  Headings also stay with what follows them and give
+// their title to the running header of pages.
+type KeepBox struct {
+	Box
+	withNext     bool
+	section      string
+	sectionLevel int
+}
+
+func (b *KeepBox) Children() []ChildBox {
+	return []ChildBox{{Box: b.Box}}
+}
+
+// keepsWithNext reports whether box, or the box it contains, must not be
+// separated from the box after it.
+func keepsWithNext(box Box) bool {
+	switch b := box.(type) {
+	case *KeepBox:
+		return b.withNext
+	case *ContainerBox:
+		return keepsWithNext(b.inner)
+	case *AnchorBox:
+		return keepsWithNext(b.Box)
+	}
+	return false
+}
+
+// An OverlayBox draws a box at an offset without taking up any space, e.g.
+// a float over the blocks that flow around it.
+type OverlayBox struct {
+	inner Box
+	pos   image.Point
+}
+
+func (b *OverlayBox) Bounds() image.Rectangle {
+	return image.Rectangle{}
+}
+
+func (b *OverlayBox) Draw(dst *ebiten.Image, x, y int) {
+	b.inner.Draw(dst, x+b.pos.X, y+b.pos.Y)
+}
+
+// A GroupBox draws boxes at arbitrary positions, in order.
+type GroupBox struct {
+	bounds   image.Rectangle
+	children []ChildBox
+}
+
+func NewGroupBox(children []ChildBox) *GroupBox {
+	var bounds image.Rectangle
+	for _, c := range children {
+		bounds = bounds.Union(c.Bounds().Add(c.Pos))
+	}
+	return &GroupBox{bounds: bounds, children: children}
+}
+
+func (b *GroupBox) Bounds() image.Rectangle {
+	return b.bounds
+}
+
+func (b *GroupBox) Draw(dst *ebiten.Image, x, y int) {
+	for _, c := range b.children {
+		c.Draw(dst, x+c.Pos.X, y+c.Pos.Y)
+	}
+}
+
+func (b *GroupBox) Children() []ChildBox {
+	return b.children
+}
+
+// A FillBox is a rectangle of solid color.
+type FillBox struct {
+	bounds image.Rectangle
+	color  color.Color
+}
+
+func (b *FillBox) Bounds() image.Rectangle {
+	return b.bounds
+}
+
+func (b *FillBox) Draw(dst *ebiten.Image, x, y int) {
+	r := b.bounds.Add(image.Pt(x, y))
+	ebitenutil.DrawRect(dst, float64(r.Min.X), float64(r.Min.Y), float64(r.Dx()), float64(r.Dy()), b.color)
+}
+
+// A ClipBox cuts a box off at a given height.
+type ClipBox struct {
+	inner  Box
+	height int
+}
+
+func (b *ClipBox) Bounds() image.Rectangle {
+	bounds := b.inner.Bounds()
+	bounds.Max.Y = minInt(bounds.Max.Y, bounds.Min.Y+b.height)
+	return bounds
+}
+
+func (b *ClipBox) Draw(dst *ebiten.Image, x, y int) {
+	clip := b.Bounds().Add(image.Pt(x, y)).Intersect(dst.Bounds())
+	if clip.Empty() {
+		return
+	}
+	b.inner.Draw(dst.SubImage(clip).(*ebiten.Image), x, y)
+}
+
+func (b *ClipBox) Children() []ChildBox {
+	return []ChildBox{{Box: b.inner}}
+}
+
+// A ScrollBox shows a window onto a box that may be wider than it, and clips
+// it.  The scroll offset is owned by the block, since boxes are laid out anew
+// whenever the view changes.
+type ScrollBox struct {
+	inner        Box
+	width        int
+	contentWidth int
+	offset       *int
+}
+
+func (b *ScrollBox) Bounds() image.Rectangle {
+	return image.Rect(0, 0, b.width, b.inner.Bounds().Dy())
+}
+
+func (b *ScrollBox) scrollX() int {
+	return clampInt(*b.offset, 0, b.contentWidth-b.width)
+}
+
+// ScrollBy scrolls the content by dx pixels, within its width.
+func (b *ScrollBox) ScrollBy(dx int) {
+	*b.offset = clampInt(b.scrollX()+dx, 0, b.contentWidth-b.width)
+}
+
+func (b *ScrollBox) Draw(dst *ebiten.Image, x, y int) {
+	clip := b.Bounds().Add(image.Pt(x, y)).Intersect(dst.Bounds())
+	if clip.Empty() {
+		return
+	}
+	b.inner.Draw(dst.SubImage(clip).(*ebiten.Image), x-b.scrollX(), y)
+}
+
+func (b *ScrollBox) SplitAt(height int) (Box, Box) {
+	first, rest := splitBox(b.inner, height)
+	switch {
+	case first == nil:
+		return nil, b
+	case rest == nil:
+		return b, nil
+	}
+	part := func(inner Box) Box {
+		s := *b
+		s.inner = inner
+		return &s
+	}
+	return part(first), part(rest)
+}
+
+func (b *ScrollBox) Children() []ChildBox {
+	return []ChildBox{{Box: b.inner, Pos: image.Pt(-b.scrollX(), 0)}}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func maxInt(a, b int) int {
 	if a > b {
 		return a
@@ -237,6 +942,36 @@ func maxInt(a, b int) int {
 	return b
 }
 
+// clampInt limits n to [lo, hi], or returns lo if hi < lo.
+func clampInt(n, lo, hi int) int {
+	if n > hi {
+		n = hi
+	}
+	if n < lo {
+		n = lo
+	}
+	return n
+}
+
+// roundUp rounds n up to a multiple of m.
+func roundUp(n, m int) int {
+	return (n + m - 1) / m * m
+}
+
+func minFixed(a, b fixed.Int26_6) fixed.Int26_6 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxFixed(a, b fixed.Int26_6) fixed.Int26_6 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 func drawRect(dst *ebiten.Image, rect image.Rectangle, clr color.Color) {
 	ebitenutil.DrawLine(dst, float64(rect.Min.X), float64(rect.Min.Y), float64(rect.Min.X), float64(rect.Max.Y), clr)
 	ebitenutil.DrawLine(dst, float64(rect.Min.X), float64(rect.Min.Y), float64(rect.Max.X), float64(rect.Min.Y), clr)
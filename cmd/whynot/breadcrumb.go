@@ -0,0 +1,113 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// A headingPos is a heading found in a laid-out box.
+type headingPos struct {
+	title string
+	level int
+	pos   image.Point
+}
+
+// boxHeadings returns the headings in a box, in order, with their positions
+// given that the box is at pos.
+func boxHeadings(box Box, pos image.Point) []headingPos {
+	var headings []headingPos
+	if k, ok := box.(*KeepBox); ok && k.section != "" {
+		headings = append(headings, headingPos{k.section, k.sectionLevel, pos})
+	}
+	if parent, ok := box.(ParentBox); ok {
+		for _, child := range parent.Children() {
+			headings = append(headings, boxHeadings(child.Box, pos.Add(child.Pos))...)
+		}
+	}
+	return headings
+}
+
+// headingPath returns the headings that lead to a vertical position: the
+// last heading above it and the headings of higher levels that contain it.
+func headingPath(headings []headingPos, y int) []headingPos {
+	var path []headingPos
+	for _, h := range headings {
+		if h.pos.Y > y {
+			break
+		}
+		for len(path) > 0 && path[len(path)-1].level >= h.level {
+			path = path[:len(path)-1]
+		}
+		path = append(path, h)
+	}
+	return path
+}
+
+// A BreadcrumbStyle is the style of the bar showing the path of headings at
+// the top of the viewport.
+type BreadcrumbStyle struct {
+	partStyle
+	Color          color.Color
+	SeparatorColor color.Color
+}
+
+// A breadcrumbBar is a laid-out breadcrumb bar and where its crumbs are.
+type breadcrumbBar struct {
+	box     Box
+	crumbs  []image.Rectangle
+	targets []headingPos
+}
+
+const breadcrumbSeparator = "›"
+
+func newBreadcrumbBar(ctx RenderingContext, style BreadcrumbStyle, path []headingPos, width int) *breadcrumbBar {
+	bar := &breadcrumbBar{targets: path}
+	d := ctx.ScaleDecoration(style.Decoration)
+	insets := d.insets()
+	bar.box = decorate(ctx, style.Decoration, width, func(width int) Box {
+		var children []ChildBox
+		x := 0
+		for i, h := range path {
+			if i > 0 {
+				sep := textLine(ctx, style.TextStyle, style.SeparatorColor, breadcrumbSeparator)
+				x += gapWidth(ctx, style.TextStyle)
+				children = append(children, ChildBox{Box: sep, Pos: image.Pt(x, 0)})
+				x += sep.Bounds().Dx() + gapWidth(ctx, style.TextStyle)
+			}
+			crumb := textLine(ctx, style.TextStyle, style.Color, h.title)
+			children = append(children, ChildBox{Box: crumb, Pos: image.Pt(x, 0)})
+			rect := crumb.Bounds().Add(image.Pt(x, 0))
+			bar.crumbs = append(bar.crumbs, rect.Add(image.Pt(int(insets.Left), int(insets.Top))))
+			x += crumb.Bounds().Dx()
+		}
+		return NewGroupBox(children)
+	})
+	return bar
+}
+
+// textLine lays out a line of text in a single style.
+func textLine(ctx RenderingContext, style TextStyle, clr color.Color, text string) Box {
+	parts := appendString(nil, text, style, clr)
+	return newLineBox(ctx, getInlineBoxes(ctx, parts, LineHeight{}, math.MaxInt32), 0, resolveBidiLevels(parts), AlignStart, 0)
+}
+
+// gapWidth returns the width of a space in the given style.
+func gapWidth(ctx RenderingContext, style TextStyle) int {
+	face, err := ctx.SelectFace(style)
+	if err != nil {
+		return 0
+	}
+	adv, _ := face.GlyphAdvance(' ')
+	return adv.Ceil()
+}
+
+// crumbAt returns the heading of the crumb at p, if any.
+func (b *breadcrumbBar) crumbAt(p image.Point) (headingPos, bool) {
+	for i, rect := range b.crumbs {
+		if p.In(rect) {
+			return b.targets[i], true
+		}
+	}
+	return headingPos{}, false
+}
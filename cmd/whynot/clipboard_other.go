@@ -0,0 +1,35 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Commands that put their input on the clipboard, in order of preference.
+var clipboardCommands = [][]string{
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+}
+
+// writeClipboard puts text on the clipboard, with the first clipboard
+// command available.
+func writeClipboard(text string) error {
+	commands := clipboardCommands
+	if runtime.GOOS == "darwin" {
+		commands = [][]string{{"pbcopy"}}
+	}
+	for _, args := range commands {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return errors.New("no clipboard command found")
+}
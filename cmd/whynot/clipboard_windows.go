@@ -0,0 +1,56 @@
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var (
+	user32           = syscall.NewLazyDLL("user32.dll")
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	openClipboard    = user32.NewProc("OpenClipboard")
+	closeClipboard   = user32.NewProc("CloseClipboard")
+	emptyClipboard   = user32.NewProc("EmptyClipboard")
+	setClipboardData = user32.NewProc("SetClipboardData")
+	globalAlloc      = kernel32.NewProc("GlobalAlloc")
+	globalFree       = kernel32.NewProc("GlobalFree")
+	globalLock       = kernel32.NewProc("GlobalLock")
+	globalUnlock     = kernel32.NewProc("GlobalUnlock")
+	lstrcpyW         = kernel32.NewProc("lstrcpyW")
+)
+
+const (
+	cfUnicodeText = 13
+	gmemMoveable  = 0x0002
+)
+
+// writeClipboard puts text on the clipboard.
+func writeClipboard(text string) error {
+	utf16, err := syscall.UTF16FromString(text)
+	if err != nil {
+		return err
+	}
+	if r, _, err := openClipboard.Call(0); r == 0 {
+		return err
+	}
+	defer closeClipboard.Call()
+	if r, _, err := emptyClipboard.Call(); r == 0 {
+		return err
+	}
+	h, _, err := globalAlloc.Call(gmemMoveable, uintptr(len(utf16)*2))
+	if h == 0 {
+		return err
+	}
+	p, _, err := globalLock.Call(h)
+	if p == 0 {
+		globalFree.Call(h)
+		return err
+	}
+	lstrcpyW.Call(p, uintptr(unsafe.Pointer(&utf16[0])))
+	globalUnlock.Call(h)
+	if r, _, err := setClipboardData.Call(cfUnicodeText, h); r == 0 {
+		globalFree.Call(h)
+		return err
+	}
+	return nil
+}
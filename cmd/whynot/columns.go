@@ -0,0 +1,124 @@
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// Blocks that span all the columns of a multi-column layout, such as headings,
+// implement this.
+type columnSpanner interface {
+	SpansColumns() bool
+}
+
+// A ColumnsBlock flows blocks into balanced columns, newspaper style.  Blocks
+// that span the columns interrupt the flow and are laid out across the whole
+// width.
+type ColumnsBlock struct {
+	blocks  []Block
+	columns int
+	gap     float64 // unscaled
+}
+
+var _ Block = (*ColumnsBlock)(nil)
+
+func (b *ColumnsBlock) Measure(ctx RenderingContext) (int, int) {
+	return b.stack().Measure(ctx)
+}
+
+func (b *ColumnsBlock) Layout(ctx RenderingContext, c Constraints) Box {
+	return clearFloats(c, func(width int) Box {
+		return b.stack().getStackBox(ctx, width, nil)
+	})
+}
+
+func (b *ColumnsBlock) Margins() Margins {
+	return b.stack().Margins()
+}
+
+// stack returns the runs of blocks to balance and the spanning blocks in
+// between, as a stack so that their margins collapse as usual.
+func (b *ColumnsBlock) stack() *StackBlock {
+	stack := &StackBlock{}
+	var run []Block
+	flush := func() {
+		if len(run) > 0 {
+			stack.blocks = append(stack.blocks, &columnRun{
+				stack:   StackBlock{blocks: run},
+				columns: b.columns,
+				gap:     b.gap,
+			})
+			run = nil
+		}
+	}
+	for _, block := range b.blocks {
+		if s, ok := block.(columnSpanner); ok && s.SpansColumns() {
+			flush()
+			stack.blocks = append(stack.blocks, block)
+			continue
+		}
+		run = append(run, block)
+	}
+	flush()
+	return stack
+}
+
+// A columnRun is a sequence of blocks split into columns of equal height.
+type columnRun struct {
+	stack   StackBlock
+	columns int
+	gap     float64
+}
+
+func (b *columnRun) Measure(ctx RenderingContext) (int, int) {
+	minWidth, maxWidth := b.stack.Measure(ctx)
+	gaps := int(math.Round(b.gap*ctx.Scale)) * (b.columns - 1)
+	return minWidth*b.columns + gaps, maxWidth*b.columns + gaps
+}
+
+func (b *columnRun) Layout(ctx RenderingContext, c Constraints) Box {
+	width := c.Width
+	gap := int(math.Round(b.gap * ctx.Scale))
+	colWidth := (width - gap*(b.columns-1)) / b.columns
+	if colWidth <= 0 {
+		return b.stack.getStackBox(ctx, width, nil)
+	}
+	box := b.stack.getStackBox(ctx, colWidth, nil)
+
+	// Find the lowest column height that fits everything.
+	total := box.Bounds().Dy()
+	lo, hi := (total+b.columns-1)/b.columns, total
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if _, rest := splitColumns(box, b.columns, mid); rest == nil {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+	columns, _ := splitColumns(box, b.columns, lo)
+	children := make([]ChildBox, len(columns))
+	for i, column := range columns {
+		children[i] = ChildBox{Box: column, Pos: image.Pt(i*(colWidth+gap), 0)}
+	}
+	return NewGroupBox(children)
+}
+
+func (b *columnRun) Margins() Margins {
+	return b.stack.Margins()
+}
+
+// splitColumns splits box into at most n columns of the given height.  It
+// returns what doesn't fit.
+func splitColumns(box Box, n, height int) ([]Box, Box) {
+	var columns []Box
+	for box != nil && len(columns) < n {
+		first, rest := splitBox(box, height)
+		if first == nil {
+			return columns, box
+		}
+		columns = append(columns, first)
+		box = rest
+	}
+	return columns, box
+}
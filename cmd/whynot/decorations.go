@@ -0,0 +1,100 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+)
+
+// A Decoration describes what is drawn around the content of a block: the
+// padding between the content and the border, a background fill and the
+// border itself.  Sizes are unscaled, like margins.
+type Decoration struct {
+	Padding      Margins
+	Background   color.Color
+	BorderWidth  float64
+	BorderColor  color.Color
+	BorderRadius float64
+}
+
+func (d Decoration) IsZero() bool {
+	return d == Decoration{}
+}
+
+// insets returns the space taken on each side by the padding and border.
+func (d Decoration) insets() Margins {
+	return Margins{
+		Top:    d.Padding.Top + d.BorderWidth,
+		Bottom: d.Padding.Bottom + d.BorderWidth,
+		Left:   d.Padding.Left + d.BorderWidth,
+		Right:  d.Padding.Right + d.BorderWidth,
+	}
+}
+
+func (c RenderingContext) ScaleDecoration(d Decoration) Decoration {
+	d.Padding = c.ScaleMargins(d.Padding)
+	d.BorderWidth *= c.Scale
+	d.BorderRadius *= c.Scale
+	return d
+}
+
+// draw paints the background and border of a decoration over rect.
+func (d Decoration) draw(dst *ebiten.Image, rect image.Rectangle) {
+	x, y := float32(rect.Min.X), float32(rect.Min.Y)
+	w, h := float32(rect.Dx()), float32(rect.Dy())
+	r := float32(d.BorderRadius)
+	if d.Background != nil {
+		var path vector.Path
+		appendRoundedRect(&path, x, y, w, h, r)
+		fillPath(dst, &path, d.Background)
+	}
+	if d.BorderWidth > 0 && d.BorderColor != nil {
+		bw := float32(d.BorderWidth)
+		var path vector.Path
+		appendRoundedRect(&path, x, y, w, h, r)
+		appendRoundedRect(&path, x+bw, y+bw, w-2*bw, h-2*bw, float32(math.Max(0, float64(r-bw))))
+		fillPath(dst, &path, d.BorderColor)
+	}
+}
+
+func appendRoundedRect(path *vector.Path, x, y, w, h, r float32) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	if limit := float32(math.Min(float64(w), float64(h))) / 2; r > limit {
+		r = limit
+	}
+	path.MoveTo(x+r, y)
+	path.LineTo(x+w-r, y)
+	path.Arc(x+w-r, y+r, r, -math.Pi/2, 0, vector.Clockwise)
+	path.LineTo(x+w, y+h-r)
+	path.Arc(x+w-r, y+h-r, r, 0, math.Pi/2, vector.Clockwise)
+	path.LineTo(x+r, y+h)
+	path.Arc(x+r, y+h-r, r, math.Pi/2, math.Pi, vector.Clockwise)
+	path.LineTo(x, y+r)
+	path.Arc(x+r, y+r, r, math.Pi, 3*math.Pi/2, vector.Clockwise)
+}
+
+var whiteImage = func() *ebiten.Image {
+	img := ebiten.NewImage(3, 3)
+	img.Fill(color.White)
+	return img.SubImage(image.Rect(1, 1, 2, 2)).(*ebiten.Image)
+}()
+
+func fillPath(dst *ebiten.Image, path *vector.Path, clr color.Color) {
+	vertices, indices := path.AppendVerticesAndIndicesForFilling(nil, nil)
+	r, g, b, a := clr.RGBA()
+	for i := range vertices {
+		vertices[i].SrcX, vertices[i].SrcY = 1, 1
+		vertices[i].ColorR = float32(r) / 0xffff
+		vertices[i].ColorG = float32(g) / 0xffff
+		vertices[i].ColorB = float32(b) / 0xffff
+		vertices[i].ColorA = float32(a) / 0xffff
+	}
+	dst.DrawTriangles(vertices, indices, whiteImage, &ebiten.DrawTrianglesOptions{
+		FillRule: ebiten.EvenOdd,
+	})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"image"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// isMarkdown reports whether a file is a Markdown document, by its name.
+func isMarkdown(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// A fileEntry is a Markdown file, or a directory containing some, listed in
+// the file tree.  Paths are absolute.
+type fileEntry struct {
+	path  string
+	name  string
+	depth int
+	dir   bool
+}
+
+// scanMarkdown lists the Markdown files in a directory and its
+// subdirectories, in order, with the directories that contain them.  The
+// directory should be absolute for the paths of the entries to be.  Hidden
+// files and directories are skipped, and so are those that can't be read,
+// which are logged.  It fails only if dir itself can't be read.
+func scanMarkdown(dir string, depth int) ([]fileEntry, error) {
+	list, err := os.ReadDir(dir)
+	if err != nil {
+		if len(list) == 0 {
+			return nil, err
+		}
+		// The entries read before the error are still listed.
+		log.Print(err)
+	}
+	var entries []fileEntry
+	for _, e := range list {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		switch {
+		case e.IsDir():
+			sub, err := scanMarkdown(path, depth+1)
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			if len(sub) > 0 {
+				entries = append(entries, fileEntry{path, name, depth, true})
+				entries = append(entries, sub...)
+			}
+		case isMarkdown(name):
+			f, err := os.Open(path)
+			if err != nil {
+				log.Print(err)
+				continue
+			}
+			f.Close()
+			entries = append(entries, fileEntry{path, name, depth, false})
+		}
+	}
+	return entries, nil
+}
+
+// startFile returns the file to open first in a directory: its README or
+// index, or else its first Markdown file.
+func startFile(files []fileEntry) (string, bool) {
+	for _, f := range files {
+		name := strings.ToLower(f.name)
+		if f.depth == 0 && !f.dir && (strings.HasPrefix(name, "readme.") || strings.HasPrefix(name, "index.")) {
+			return f.path, true
+		}
+	}
+	for _, f := range files {
+		if !f.dir {
+			return f.path, true
+		}
+	}
+	return "", false
+}
+
+// absPath returns the absolute path of a file, or the path as is if it can't
+// be made absolute.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// fileIndex returns the index of the entry of a file, or -1.
+func fileIndex(files []fileEntry, file string) int {
+	abs := absPath(file)
+	for i, f := range files {
+		if !f.dir && f.path == abs {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameFile reports whether two paths name the same file.
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
+
+// A fileTreePanel is a laid-out file tree and where its entries are.
+type fileTreePanel struct {
+	box     Box
+	entries []image.Rectangle
+	files   []fileEntry
+	height  int // of the entries and padding, however far they are scrolled
+}
+
+// newFileTreePanel lays out the files as an indented tree, with the current
+// one highlighted, in a panel of the given size.  Entries are moved up by
+// offset.
+func newFileTreePanel(ctx RenderingContext, style TOCStyle, files []fileEntry, current int, size image.Point, offset int) *fileTreePanel {
+	items := make([]treeItem, len(files))
+	for i, f := range files {
+		items[i] = treeItem{f.name, f.depth}
+		if f.dir {
+			items[i].title += "/"
+		}
+	}
+	box, entries, height := layoutTree(ctx, style, items, current, size, offset)
+	return &fileTreePanel{box: box, entries: entries, files: files, height: height}
+}
+
+// fileAt returns the file of the entry at p, if any.  Directories can't be
+// opened.
+func (p *fileTreePanel) fileAt(pt image.Point) (string, bool) {
+	for i, rect := range p.entries {
+		if pt.In(rect) && !p.files[i].dir {
+			return p.files[i].path, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTree creates files, given by their slash-separated paths, in dir.
+func writeTree(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# "+f+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScanMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir,
+		"README.md",
+		"b.markdown",
+		"notes.txt",
+		".secret.md",
+		".hidden/x.md",
+		"a/z.md",
+		"a/deep/y.MD",
+		"empty/c.txt",
+	)
+	got, err := scanMarkdown(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	join := func(elem ...string) string { return filepath.Join(append([]string{dir}, elem...)...) }
+	want := []fileEntry{
+		{join("README.md"), "README.md", 0, false},
+		{join("a"), "a", 0, true},
+		{join("a", "deep"), "deep", 1, true},
+		{join("a", "deep", "y.MD"), "y.MD", 2, false},
+		{join("a", "z.md"), "z.md", 1, false},
+		{join("b.markdown"), "b.markdown", 0, false},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+	if start, ok := startFile(got); !ok || start != join("README.md") {
+		t.Errorf("startFile = %q, %t, want the README", start, ok)
+	}
+	if i := fileIndex(got, join("a", "z.md")); i != 4 {
+		t.Errorf("fileIndex(a/z.md) = %d, want 4", i)
+	}
+	if i := fileIndex(got, join("a")); i != -1 {
+		t.Errorf("fileIndex(a) = %d, want -1 for a directory", i)
+	}
+}
+
+func TestScanMarkdownSkipsUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, "a.md", "locked/b.md", "z.md")
+	locked := filepath.Join(dir, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Skip(err)
+	}
+	defer os.Chmod(locked, 0o755)
+	if _, err := os.ReadDir(locked); err == nil {
+		t.Skip("directories without permissions can still be read")
+	}
+	got, err := scanMarkdown(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range got {
+		names = append(names, e.name)
+	}
+	if want := []string{"a.md", "z.md"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+}
+
+func TestScanMarkdownMissing(t *testing.T) {
+	if _, err := scanMarkdown(filepath.Join(t.TempDir(), "missing"), 0); err == nil {
+		t.Errorf("scanning a missing directory didn't fail")
+	}
+}
+
+func TestStartFile(t *testing.T) {
+	tests := []struct {
+		files []fileEntry
+		want  string
+		ok    bool
+	}{
+		{[]fileEntry{{"/d/a.md", "a.md", 0, false}, {"/d/index.md", "index.md", 0, false}}, "/d/index.md", true},
+		{[]fileEntry{{"/d/a.md", "a.md", 0, false}, {"/d/Readme.markdown", "Readme.markdown", 0, false}}, "/d/Readme.markdown", true},
+		// Only the README at the top counts.
+		{[]fileEntry{{"/d/s", "s", 0, true}, {"/d/s/README.md", "README.md", 1, false}, {"/d/b.md", "b.md", 0, false}}, "/d/s/README.md", true},
+		{[]fileEntry{{"/d/s", "s", 0, true}, {"/d/s/x.md", "x.md", 1, false}}, "/d/s/x.md", true},
+		{nil, "", false},
+	}
+	for _, test := range tests {
+		got, ok := startFile(test.files)
+		if got != test.want || ok != test.ok {
+			t.Errorf("startFile(%v) = %q, %t, want %q, %t", test.files, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestIsMarkdown(t *testing.T) {
+	for name, want := range map[string]bool{
+		"a.md":       true,
+		"A.MD":       true,
+		"b.markdown": true,
+		"c.txt":      false,
+		"md":         false,
+		"d.md.bak":   false,
+	} {
+		if got := isMarkdown(name); got != want {
+			t.Errorf("isMarkdown(%q) = %t, want %t", name, got, want)
+		}
+	}
+}
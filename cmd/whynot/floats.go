@@ -0,0 +1,105 @@
+package main
+
+import (
+	"image"
+)
+
+type Float int
+
+const (
+	FloatNone Float = iota
+	FloatLeft
+	FloatRight
+)
+
+// A floatArea is the space taken by a float, including its margins, which
+// lines of text have to avoid.
+type floatArea struct {
+	rect image.Rectangle
+	side Float
+}
+
+func translateFloats(floats []floatArea, d image.Point) []floatArea {
+	moved := make([]floatArea, len(floats))
+	for i, f := range floats {
+		moved[i] = floatArea{f.rect.Add(d), f.side}
+	}
+	return moved
+}
+
+// lineSpan returns the horizontal span left free by the floats between top
+// and bottom, within width.
+func lineSpan(floats []floatArea, top, bottom, width int) (int, int) {
+	left, right := 0, width
+	for _, f := range floats {
+		if f.rect.Max.Y <= top || f.rect.Min.Y >= bottom {
+			continue
+		}
+		switch f.side {
+		case FloatLeft:
+			left = maxInt(left, f.rect.Max.X)
+		case FloatRight:
+			right = minInt(right, f.rect.Min.X)
+		}
+	}
+	return minInt(left, width), maxInt(right, 0)
+}
+
+// floatsBottom returns the bottom of the lowest float.
+func floatsBottom(floats []floatArea) int {
+	bottom := 0
+	for _, f := range floats {
+		bottom = maxInt(bottom, f.rect.Max.Y)
+	}
+	return bottom
+}
+
+// A FloatBlock is an image at the side of the column, which the following
+// blocks flow around.  Its side margins separate it from the text.
+type FloatBlock struct {
+	margins  Margins
+	image    *InlineImage
+	side     Float
+	maxWidth float64 // as a fraction of the column
+}
+
+var _ Block = (*FloatBlock)(nil)
+
+// A float is at most a fraction of the column wide, so it has no minimum
+// width.
+func (b *FloatBlock) Measure(ctx RenderingContext) (int, int) {
+	_, maxWidth := measureInline([]InlineBox{b.image.GetInlineBox(ctx)}, 0)
+	return 0, maxWidth
+}
+
+// Layout lays out the image of the float.  Stacks place it with place.
+func (b *FloatBlock) Layout(ctx RenderingContext, c Constraints) Box {
+	img := b.image.GetInlineBox(ctx)
+	img.(widthFitter).FitWidth(int(float64(c.Width) * b.maxWidth))
+	return newLineBox(ctx, []InlineBox{img}, 0, 0, AlignStart, c.Width)
+}
+
+func (b *FloatBlock) Margins() Margins {
+	return b.margins
+}
+
+// place lays out the float in a column at the given height, below the floats
+// already on the same side, and returns its box and position and the area
+// it takes.
+func (b *FloatBlock) place(ctx RenderingContext, colLeft, colWidth, y int, floats []floatArea) (Box, image.Point, floatArea) {
+	margins := ctx.ScaleMargins(b.margins)
+	box := b.Layout(ctx, Constraints{Width: colWidth})
+	w, h := box.Bounds().Dx(), box.Bounds().Dy()
+	for _, f := range floats {
+		if f.side == b.side && f.rect.Max.Y > y {
+			y = f.rect.Max.Y
+		}
+	}
+	pos := image.Pt(colLeft, y)
+	area := floatArea{side: b.side, rect: image.Rect(colLeft, y, colLeft+w+int(margins.Right), y+h+int(margins.Bottom))}
+	if b.side == FloatRight {
+		pos.X = colLeft + colWidth - w
+		area.rect = image.Rect(pos.X-int(margins.Left), y, colLeft+colWidth, y+h+int(margins.Bottom))
+	}
+	return box, pos, area
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"image/color"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokenPlain tokenKind = iota
+	tokenKeyword
+	tokenType
+	tokenString
+	tokenNumber
+	tokenComment
+	tokenKey
+	tokenInserted
+	tokenDeleted
+	tokenMeta
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// A SyntaxPalette gives the colors of the kinds of tokens.  Nil colors fall
+// back to the plain code color.
+type SyntaxPalette struct {
+	Keyword  color.Color
+	Type     color.Color
+	String   color.Color
+	Number   color.Color
+	Comment  color.Color
+	Key      color.Color
+	Inserted color.Color
+	Deleted  color.Color
+	Meta     color.Color
+}
+
+func (p SyntaxPalette) color(kind tokenKind, plain color.Color) color.Color {
+	var c color.Color
+	switch kind {
+	case tokenKeyword:
+		c = p.Keyword
+	case tokenType:
+		c = p.Type
+	case tokenString:
+		c = p.String
+	case tokenNumber:
+		c = p.Number
+	case tokenComment:
+		c = p.Comment
+	case tokenKey:
+		c = p.Key
+	case tokenInserted:
+		c = p.Inserted
+	case tokenDeleted:
+		c = p.Deleted
+	case tokenMeta:
+		c = p.Meta
+	}
+	if c == nil {
+		return plain
+	}
+	return c
+}
+
+// A syntax describes the lexical structure of a language well enough to
+// color it.  Languages whose structure is mostly per line, like diffs, use a
+// line function instead.
+type syntax struct {
+	keywords     map[string]bool
+	types        map[string]bool
+	lineComment  string
+	blockComment [2]string
+	quotes       []string // string delimiters, longest first
+	multiline    []string // delimiters of strings that may span lines
+	raw          []string // delimiters of strings without escapes
+	colonKeys    bool     // a name or string followed by ':' is a key
+	variables    bool     // $name and ${name} are variables
+	line         func(line string, state *lexState) []token
+}
+
+// lexState is what a syntax needs to remember from one line to the next: the
+// delimiter that closes a comment or string still open at the end of the
+// previous line.
+type lexState struct {
+	closer string
+	kind   tokenKind
+}
+
+func words(s string) map[string]bool {
+	m := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var syntaxes = map[string]*syntax{
+	"go": {
+		keywords: words(`break case chan const continue default defer else fallthrough for func go goto if
+			import interface map package range return select struct switch type var`),
+		types: words(`bool byte complex64 complex128 error float32 float64 int int8 int16 int32 int64 rune
+			string uint uint8 uint16 uint32 uint64 uintptr any true false nil iota append cap close
+			copy delete len make new panic print println recover`),
+		lineComment:  "//",
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       []string{`"`, "'", "`"},
+		multiline:    []string{"`"},
+		raw:          []string{"`"},
+	},
+	"python": {
+		keywords: words(`False None True and as assert async await break class continue def del elif else
+			except finally for from global if import in is lambda nonlocal not or pass raise return try
+			while with yield`),
+		types: words(`bool bytes dict float int list object set str tuple len print range self super
+			isinstance enumerate zip open`),
+		lineComment: "#",
+		quotes:      []string{`"""`, `'''`, `"`, "'"},
+		multiline:   []string{`"""`, `'''`},
+	},
+	"shell": {
+		keywords: words(`if then else elif fi for while until do done case esac function in return
+			export local readonly unset shift exit break continue`),
+		types:       words(`cd echo printf read test source eval exec set trap wait true false`),
+		lineComment: "#",
+		quotes:      []string{`"`, "'"},
+		raw:         []string{"'"},
+		variables:   true,
+	},
+	"json": {
+		keywords:  words(`true false null`),
+		quotes:    []string{`"`},
+		colonKeys: true,
+	},
+	"yaml": {
+		keywords:    words(`true false null yes no on off`),
+		lineComment: "#",
+		quotes:      []string{`"`, "'"},
+		raw:         []string{"'"},
+		colonKeys:   true,
+	},
+	"diff": {
+		line: diffLine,
+	},
+	"markdown": {
+		line: markdownLine,
+	},
+}
+
+var languageAliases = map[string]string{
+	"golang":  "go",
+	"py":      "python",
+	"python3": "python",
+	"sh":      "shell",
+	"bash":    "shell",
+	"zsh":     "shell",
+	"console": "shell",
+	"yml":     "yaml",
+	"patch":   "diff",
+	"md":      "markdown",
+	"jsonc":   "json",
+}
+
+// lookupSyntax returns the syntax for the language of a fenced code block,
+// or nil if it isn't known.
+func lookupSyntax(lang string) *syntax {
+	lang = strings.ToLower(lang)
+	if alias, ok := languageAliases[lang]; ok {
+		lang = alias
+	}
+	return syntaxes[lang]
+}
+
+// highlight splits lines of code into tokens.
+func (s *syntax) highlight(lines []string) [][]token {
+	tokens := make([][]token, len(lines))
+	var state lexState
+	for i, line := range lines {
+		if s.line != nil {
+			tokens[i] = s.line(line, &state)
+		} else {
+			tokens[i] = s.lexLine(line, &state)
+		}
+	}
+	return tokens
+}
+
+func (s *syntax) lexLine(line string, state *lexState) []token {
+	var tokens []token
+	emit := func(kind tokenKind, text string) {
+		if text == "" {
+			return
+		}
+		if n := len(tokens); n > 0 && tokens[n-1].kind == kind {
+			tokens[n-1].text += text
+			return
+		}
+		tokens = append(tokens, token{kind, text})
+	}
+
+	pos := 0
+	if state.closer != "" {
+		end := s.findCloser(line, 0, state.closer)
+		if end < 0 {
+			emit(state.kind, line)
+			return tokens
+		}
+		emit(state.kind, line[:end])
+		pos = end
+		*state = lexState{}
+	}
+
+	for pos < len(line) {
+		rest := line[pos:]
+		r, size := utf8.DecodeRuneInString(rest)
+		switch {
+		case unicode.IsSpace(r):
+			emit(tokenPlain, rest[:size])
+			pos += size
+			continue
+		case s.lineComment != "" && strings.HasPrefix(rest, s.lineComment) &&
+			(pos == 0 || !s.variables || unicode.IsSpace(rune(line[pos-1]))):
+			emit(tokenComment, rest)
+			return tokens
+		case s.blockComment[0] != "" && strings.HasPrefix(rest, s.blockComment[0]):
+			open := len(s.blockComment[0])
+			end := strings.Index(rest[open:], s.blockComment[1])
+			if end < 0 {
+				emit(tokenComment, rest)
+				*state = lexState{closer: s.blockComment[1], kind: tokenComment}
+				return tokens
+			}
+			end += open + len(s.blockComment[1])
+			emit(tokenComment, rest[:end])
+			pos += end
+			continue
+		case s.variables && r == '$' && len(rest) > 1:
+			end := 1
+			if rest[1] == '{' {
+				if i := strings.IndexByte(rest, '}'); i > 0 {
+					end = i + 1
+				}
+			} else {
+				end += identLength(rest[1:])
+			}
+			emit(tokenType, rest[:end])
+			pos += end
+			continue
+		}
+
+		if quote := s.quoteAt(rest); quote != "" {
+			end := s.findCloser(rest, len(quote), quote)
+			if end < 0 {
+				emit(tokenString, rest)
+				if contains(s.multiline, quote) {
+					*state = lexState{closer: quote, kind: tokenString}
+				}
+				return tokens
+			}
+			kind := tokenString
+			if s.colonKeys && strings.HasPrefix(strings.TrimLeft(rest[end:], " \t"), ":") {
+				kind = tokenKey
+			}
+			emit(kind, rest[:end])
+			pos += end
+			continue
+		}
+
+		switch {
+		case isDigit(rest[0]) || rest[0] == '.' && len(rest) > 1 && isDigit(rest[1]):
+			end := 1
+			for end < len(rest) && (isIdentByte(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			emit(tokenNumber, rest[:end])
+			pos += end
+		case r == '_' || unicode.IsLetter(r):
+			end := identLength(rest)
+			word := rest[:end]
+			kind := tokenPlain
+			switch {
+			case s.colonKeys && strings.HasPrefix(strings.TrimLeft(rest[end:], " \t"), ":"):
+				kind = tokenKey
+			case s.keywords[word]:
+				kind = tokenKeyword
+			case s.types[word]:
+				kind = tokenType
+			}
+			emit(kind, word)
+			pos += end
+		default:
+			emit(tokenPlain, rest[:size])
+			pos += size
+		}
+	}
+	return tokens
+}
+
+// quoteAt returns the string delimiter at the start of s, if any.
+func (s *syntax) quoteAt(text string) string {
+	for _, q := range s.quotes {
+		if strings.HasPrefix(text, q) {
+			return q
+		}
+	}
+	return ""
+}
+
+// findCloser returns the position just after the delimiter that closes a
+// string or comment, looking from start, or -1 if it isn't on this line.
+func (s *syntax) findCloser(text string, start int, closer string) int {
+	escapes := !contains(s.raw, closer) && closer != s.blockComment[1]
+	for i := start; i < len(text); i++ {
+		if escapes && text[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(text[i:], closer) {
+			return i + len(closer)
+		}
+	}
+	return -1
+}
+
+func identLength(s string) int {
+	n := 0
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || isDigit(c) || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func diffLine(line string, state *lexState) []token {
+	kind := tokenPlain
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"),
+		strings.HasPrefix(line, "@@"), strings.HasPrefix(line, "diff "),
+		strings.HasPrefix(line, "index "):
+		kind = tokenMeta
+	case strings.HasPrefix(line, "+"):
+		kind = tokenInserted
+	case strings.HasPrefix(line, "-"):
+		kind = tokenDeleted
+	}
+	return []token{{kind, line}}
+}
+
+func markdownLine(line string, state *lexState) []token {
+	trimmed := strings.TrimLeft(line, " ")
+	indent := line[:len(line)-len(trimmed)]
+	if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+		if state.closer == "" {
+			*state = lexState{closer: trimmed[:3], kind: tokenString}
+		} else if strings.HasPrefix(trimmed, state.closer) {
+			*state = lexState{}
+		}
+		return []token{{tokenMeta, line}}
+	}
+	if state.closer != "" {
+		return []token{{tokenString, line}}
+	}
+	switch {
+	case strings.HasPrefix(trimmed, "#"):
+		return []token{{tokenKeyword, line}}
+	case strings.HasPrefix(trimmed, ">"):
+		return []token{{tokenComment, line}}
+	}
+	tokens := []token{{tokenPlain, indent}}
+	if marker := listMarkerLength(trimmed); marker > 0 {
+		tokens = append(tokens, token{tokenMeta, trimmed[:marker]})
+		trimmed = trimmed[marker:]
+	}
+	// Code spans.
+	for {
+		start := strings.IndexByte(trimmed, '`')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(trimmed[start+1:], '`')
+		if end < 0 {
+			break
+		}
+		end += start + 2
+		tokens = append(tokens, token{tokenPlain, trimmed[:start]}, token{tokenString, trimmed[start:end]})
+		trimmed = trimmed[end:]
+	}
+	return append(tokens, token{tokenPlain, trimmed})
+}
+
+// listMarkerLength returns the length of a list item marker and the space
+// after it at the start of s, or 0.
+func listMarkerLength(s string) int {
+	if len(s) >= 2 && strings.ContainsRune("-*+", rune(s[0])) && s[1] == ' ' {
+		return 2
+	}
+	n := 0
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	if n > 0 && n+1 < len(s) && (s[n] == '.' || s[n] == ')') && s[n+1] == ' ' {
+		return n + 2
+	}
+	return 0
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// highlightTest is lines of code in a language and the tokens they are split
+// into, leaving out empty ones.
+type highlightTest struct {
+	lang  string
+	lines []string
+	want  [][]token
+}
+
+func (test highlightTest) run(t *testing.T) {
+	t.Helper()
+	s := lookupSyntax(test.lang)
+	if s == nil {
+		t.Fatalf("no syntax for %q", test.lang)
+	}
+	got := s.highlight(test.lines)
+	for i, line := range got {
+		tokens := []token{}
+		for _, tok := range line {
+			if tok.text != "" {
+				tokens = append(tokens, tok)
+			}
+		}
+		got[i] = tokens
+	}
+	if !reflect.DeepEqual(got, test.want) {
+		t.Errorf("%s %q:\ngot  %v\nwant %v", test.lang, test.lines, got, test.want)
+	}
+}
+
+func TestLookupSyntax(t *testing.T) {
+	for _, lang := range []string{"go", "Go", "golang", "py", "bash", "yml", "patch", "md", "jsonc"} {
+		if lookupSyntax(lang) == nil {
+			t.Errorf("lookupSyntax(%q) = nil", lang)
+		}
+	}
+	if s := lookupSyntax("cobol"); s != nil {
+		t.Errorf("lookupSyntax(cobol) = %v, want nil", s)
+	}
+	if lookupSyntax("golang") != lookupSyntax("go") {
+		t.Errorf("golang isn't an alias of go")
+	}
+}
+
+func TestHighlightGo(t *testing.T) {
+	tests := []highlightTest{
+		{"go", []string{`func f(x int) string {`}, [][]token{{
+			{tokenKeyword, "func"}, {tokenPlain, " f(x "}, {tokenType, "int"}, {tokenPlain, ") "},
+			{tokenType, "string"}, {tokenPlain, " {"},
+		}}},
+		{"go", []string{`s := "a \"b\" c" // done`}, [][]token{{
+			{tokenPlain, "s := "}, {tokenString, `"a \"b\" c"`}, {tokenPlain, " "}, {tokenComment, "// done"},
+		}}},
+		{"go", []string{`x := 0x1F + 3.5e2 + .5`}, [][]token{{
+			{tokenPlain, "x := "}, {tokenNumber, "0x1F"}, {tokenPlain, " + "}, {tokenNumber, "3.5e2"},
+			{tokenPlain, " + "}, {tokenNumber, ".5"},
+		}}},
+		{"go", []string{"a /* b", "c */ return"}, [][]token{
+			{{tokenPlain, "a "}, {tokenComment, "/* b"}},
+			{{tokenComment, "c */"}, {tokenPlain, " "}, {tokenKeyword, "return"}},
+		}},
+		{"go", []string{"s := `raw \\", "still` + 1"}, [][]token{
+			{{tokenPlain, "s := "}, {tokenString, "`raw \\"}},
+			{{tokenString, "still`"}, {tokenPlain, " + "}, {tokenNumber, "1"}},
+		}},
+		// Double quoted strings don't span lines.
+		{"go", []string{`"open`, `var`}, [][]token{
+			{{tokenString, `"open`}},
+			{{tokenKeyword, "var"}},
+		}},
+		{"go", []string{`café := nil`}, [][]token{{
+			{tokenPlain, "café := "}, {tokenType, "nil"},
+		}}},
+	}
+	for _, test := range tests {
+		test.run(t)
+	}
+}
+
+func TestHighlightPython(t *testing.T) {
+	tests := []highlightTest{
+		{"python", []string{`def f(self): # hi`}, [][]token{{
+			{tokenKeyword, "def"}, {tokenPlain, " f("}, {tokenType, "self"}, {tokenPlain, "): "},
+			{tokenComment, "# hi"},
+		}}},
+		{"python", []string{`x = """doc`, `more""" + 'y'`}, [][]token{
+			{{tokenPlain, "x = "}, {tokenString, `"""doc`}},
+			{{tokenString, `more"""`}, {tokenPlain, " + "}, {tokenString, "'y'"}},
+		}},
+	}
+	for _, test := range tests {
+		test.run(t)
+	}
+}
+
+func TestHighlightShell(t *testing.T) {
+	tests := []highlightTest{
+		{"shell", []string{`echo $HOME ${x} # note`}, [][]token{{
+			{tokenType, "echo"}, {tokenPlain, " "}, {tokenType, "$HOME"}, {tokenPlain, " "},
+			{tokenType, "${x}"}, {tokenPlain, " "}, {tokenComment, "# note"},
+		}}},
+		// # only starts a comment at the start of a word.
+		{"shell", []string{`echo a#b`}, [][]token{{
+			{tokenType, "echo"}, {tokenPlain, " a#b"},
+		}}},
+		// Single quotes have no escapes.
+		{"shell", []string{`x='a\' y`}, [][]token{{
+			{tokenPlain, "x="}, {tokenString, `'a\'`}, {tokenPlain, " y"},
+		}}},
+	}
+	for _, test := range tests {
+		test.run(t)
+	}
+}
+
+func TestHighlightData(t *testing.T) {
+	tests := []highlightTest{
+		{"json", []string{`{"a": true, "b": "c"}`}, [][]token{{
+			{tokenPlain, "{"}, {tokenKey, `"a"`}, {tokenPlain, ": "}, {tokenKeyword, "true"},
+			{tokenPlain, ", "}, {tokenKey, `"b"`}, {tokenPlain, ": "}, {tokenString, `"c"`}, {tokenPlain, "}"},
+		}}},
+		{"yaml", []string{`name: yes # why`}, [][]token{{
+			{tokenKey, "name"}, {tokenPlain, ": "}, {tokenKeyword, "yes"}, {tokenPlain, " "},
+			{tokenComment, "# why"},
+		}}},
+	}
+	for _, test := range tests {
+		test.run(t)
+	}
+}
+
+func TestHighlightDiff(t *testing.T) {
+	highlightTest{"diff", []string{"--- a", "+++ b", "@@ -1 +1 @@", "-old", "+new", " same"}, [][]token{
+		{{tokenMeta, "--- a"}},
+		{{tokenMeta, "+++ b"}},
+		{{tokenMeta, "@@ -1 +1 @@"}},
+		{{tokenDeleted, "-old"}},
+		{{tokenInserted, "+new"}},
+		{{tokenPlain, " same"}},
+	}}.run(t)
+}
+
+func TestHighlightMarkdown(t *testing.T) {
+	highlightTest{"markdown", []string{
+		"# Title",
+		"> quote",
+		"  - item with `code`",
+		"12. step",
+		"```go",
+		"# not a heading",
+		"```",
+		"text",
+	}, [][]token{
+		{{tokenKeyword, "# Title"}},
+		{{tokenComment, "> quote"}},
+		{{tokenPlain, "  "}, {tokenMeta, "- "}, {tokenPlain, "item with "}, {tokenString, "`code`"}},
+		{{tokenMeta, "12. "}, {tokenPlain, "step"}},
+		{{tokenMeta, "```go"}},
+		{{tokenString, "# not a heading"}},
+		{{tokenMeta, "```"}},
+		{{tokenPlain, "text"}},
+	}}.run(t)
+}
+
+func TestListMarkerLength(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"- a", 2},
+		{"* a", 2},
+		{"1. a", 3},
+		{"10) a", 4},
+		{"-a", 0},
+		{"1.a", 0},
+		{"1.", 0},
+		{"a. b", 0},
+	}
+	for _, test := range tests {
+		if got := listMarkerLength(test.s); got != test.want {
+			t.Errorf("listMarkerLength(%q) = %d, want %d", test.s, got, test.want)
+		}
+	}
+}
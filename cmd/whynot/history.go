@@ -0,0 +1,91 @@
+package main
+
+import (
+	"image"
+	"net/url"
+	"path"
+	"path/filepath"
+)
+
+// linkAt returns the destination of the link at p, if any.
+func linkAt(runs []textRun, p image.Point) (string, bool) {
+	for _, r := range runs {
+		if t, ok := r.box.(*TextBox); ok && t.link != "" && p.In(r.rect) {
+			return t.link, true
+		}
+	}
+	return "", false
+}
+
+// resolveLink returns the file a link from a document points to, if it is a
+// relative link to a Markdown document.  The fragment is ignored.
+func resolveLink(from, destination string) (string, bool) {
+	u, err := url.Parse(destination)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || path.IsAbs(u.Path) {
+		return "", false
+	}
+	if !isMarkdown(u.Path) {
+		return "", false
+	}
+	return filepath.Join(filepath.Dir(from), filepath.FromSlash(u.Path)), true
+}
+
+// resolveImage returns the file of an image in a document of a directory.
+// Absolute paths and URLs are left as they are.
+func resolveImage(dir, destination string) string {
+	if u, err := url.Parse(destination); err != nil || u.Scheme != "" || u.Host != "" {
+		return destination
+	}
+	if filepath.IsAbs(destination) || path.IsAbs(destination) {
+		return destination
+	}
+	return filepath.Join(dir, filepath.FromSlash(destination))
+}
+
+// A visit is a document shown and how far it was scrolled.
+type visit struct {
+	file   string
+	offset float64
+}
+
+// A history is the documents visited before the current one, and those gone
+// back from, as in a browser.
+type history struct {
+	back    []visit
+	forward []visit
+}
+
+// push records the current document when leaving it for a new one, which
+// forgets the documents gone back from.
+func (h *history) push(current visit) {
+	h.back = append(h.back, current)
+	h.forward = nil
+}
+
+// goBack returns the previous document and records the current one to go
+// forward to.
+func (h *history) goBack(current visit) (visit, bool) {
+	if len(h.back) == 0 {
+		return visit{}, false
+	}
+	v := h.back[len(h.back)-1]
+	h.back = h.back[:len(h.back)-1]
+	h.forward = append(h.forward, current)
+	return v, true
+}
+
+// goForward undoes goBack.
+func (h *history) goForward(current visit) (visit, bool) {
+	if len(h.forward) == 0 {
+		return visit{}, false
+	}
+	v := h.forward[len(h.forward)-1]
+	h.forward = h.forward[:len(h.forward)-1]
+	h.back = append(h.back, current)
+	return v, true
+}
+
+// windowTitle returns the title of the window showing a document.
+func windowTitle(file string) string {
+	return filepath.Base(file) + " - Why Not?"
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveLink(t *testing.T) {
+	from := filepath.Join("docs", "guide", "index.md")
+	tests := []struct {
+		destination string
+		want        string
+		ok          bool
+	}{
+		{"intro.md", filepath.Join("docs", "guide", "intro.md"), true},
+		{"../README.md", filepath.Join("docs", "README.md"), true},
+		{"sub/page.markdown#section", filepath.Join("docs", "guide", "sub", "page.markdown"), true},
+		{"./a%20b.md", filepath.Join("docs", "guide", "a b.md"), true},
+		{"https://example.com/a.md", "", false},
+		{"//example.com/a.md", "", false},
+		{"/abs/a.md", "", false},
+		{"mailto:someone@example.com", "", false},
+		{"#section", "", false},
+		{"picture.png", "", false},
+		{"", "", false},
+	}
+	for _, test := range tests {
+		got, ok := resolveLink(from, test.destination)
+		if got != test.want || ok != test.ok {
+			t.Errorf("resolveLink(%q) = %q, %t, want %q, %t", test.destination, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestResolveImage(t *testing.T) {
+	dir := filepath.Join("docs", "guide")
+	abs, err := filepath.Abs(filepath.Join("images", "a.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		destination string
+		want        string
+	}{
+		{"cat.jpeg", filepath.Join("docs", "guide", "cat.jpeg")},
+		{"../img/cat.jpeg", filepath.Join("docs", "img", "cat.jpeg")},
+		{abs, abs},
+		{"/images/a.png", "/images/a.png"},
+		{"https://example.com/cat.jpeg", "https://example.com/cat.jpeg"},
+	}
+	for _, test := range tests {
+		if got := resolveImage(dir, test.destination); got != test.want {
+			t.Errorf("resolveImage(%q) = %q, want %q", test.destination, got, test.want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	var h history
+	a, b, c, d := visit{"a.md", 0}, visit{"b.md", -100}, visit{"c.md", -50}, visit{"d.md", 0}
+	if _, ok := h.goBack(a); ok {
+		t.Fatalf("went back with an empty history")
+	}
+
+	// a -> b -> c
+	h.push(a)
+	h.push(b)
+	got, ok := h.goBack(c)
+	if !ok || got != b {
+		t.Fatalf("back from c = %v, %t, want %v", got, ok, b)
+	}
+	got, ok = h.goBack(b)
+	if !ok || got != a {
+		t.Fatalf("back from b = %v, %t, want %v", got, ok, a)
+	}
+	if _, ok := h.goBack(a); ok {
+		t.Fatalf("went back past the first document")
+	}
+	got, ok = h.goForward(a)
+	if !ok || got != b {
+		t.Fatalf("forward from a = %v, %t, want %v", got, ok, b)
+	}
+	if want := (history{back: []visit{a}, forward: []visit{c}}); !reflect.DeepEqual(h, want) {
+		t.Fatalf("history = %v, want %v", h, want)
+	}
+
+	// Going to a new document forgets those gone back from.
+	h.push(b)
+	if _, ok := h.goForward(d); ok {
+		t.Errorf("went forward after following a link")
+	}
+	got, ok = h.goBack(d)
+	if !ok || got != b {
+		t.Errorf("back from d = %v, %t, want %v", got, ok, b)
+	}
+}
@@ -2,62 +2,1028 @@ package main
 
 import (
 	"flag"
+	"image"
+	"image/color"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
 func main() {
+	theme := DefaultTheme()
+	fontFile := flag.String("font", "", "OpenType font file for proportional text, instead of the Go fonts")
+	baselineGrid := flag.Float64("baseline-grid", 0, "snap lines and block gaps to a baseline grid of this height")
+	flag.Var(&theme.measure.MaxWidth, "measure", "maximum width of the text column, in px or em (0 for none)")
+	flag.Var(&theme.measure.BreakoutWidth, "breakout", "maximum width of code blocks, in px or em (0 for none)")
+	flag.BoolVar(&theme.codeBlockBreakout, "code-breakout", theme.codeBlockBreakout, "let code blocks be wider than the text column")
+	flag.IntVar(&theme.columns, "columns", theme.columns, "number of columns to lay the document out in")
+	flag.Float64Var(&theme.columnGap, "column-gap", theme.columnGap, "gap between columns")
+	flag.BoolVar(&theme.spanHeadings, "span-headings", theme.spanHeadings, "let headings span all columns")
+	flag.IntVar(&theme.tabWidth, "tab-width", theme.tabWidth, "width of tab stops in code blocks")
+	flag.BoolVar(&theme.codeWrap, "wrap-code", theme.codeWrap, "wrap long lines in code blocks instead of scrolling them")
+	paged := flag.Bool("paged", false, "show the document page by page")
+	present := flag.Bool("present", false, "present the document as slides, split at thematic breaks and level 1 and 2 headings")
+	showTOC := flag.Bool("toc", false, "show the table of contents (toggled with T)")
+	showMinimap := flag.Bool("minimap", false, "show a minimap of the document (toggled with M)")
+	flag.Float64Var(&theme.pageLayout.Width, "page-width", theme.pageLayout.Width, "width of pages")
+	flag.Float64Var(&theme.pageLayout.Height, "page-height", theme.pageLayout.Height, "height of pages")
 	flag.Parse()
-	f := "test.md"
-	if flag.NArg() != 0 {
-		f = flag.Arg(0)
+
+	// Several files open in tabs, and a directory is browsed from its
+	// README, or its first Markdown file.  Either way the files are listed
+	// in a side panel.
+	paths := flag.Args()
+	var files []fileEntry
+	several := len(paths) > 1
+	switch {
+	case len(paths) == 0:
+		paths = []string{"test.md"}
+	case len(paths) == 1:
+		if info, err := os.Stat(paths[0]); err == nil && info.IsDir() {
+			entries, err := scanMarkdown(absPath(paths[0]), 0)
+			if err != nil {
+				log.Fatal(err)
+			}
+			start, ok := startFile(entries)
+			if !ok {
+				log.Fatalf("no Markdown files in %s", paths[0])
+			}
+			files, paths = entries, []string{start}
+		}
 	}
-	source, err := os.ReadFile(f)
-	if err != nil {
-		panic(err)
+	var tabs []*document
+	for _, path := range paths {
+		doc, err := openDocument(path, theme)
+		if err != nil {
+			if !several {
+				panic(err)
+			}
+			// The other files are still shown.
+			log.Print(err)
+			continue
+		}
+		tabs = append(tabs, doc)
+		if several {
+			files = append(files, fileEntry{path: absPath(path), name: filepath.Base(path)})
+		}
+	}
+	if len(tabs) == 0 {
+		log.Fatal("no documents to show")
 	}
-	block := parseMarkdown(source)
 
 	ebiten.SetWindowSize(1024, 768)
-	ebiten.SetWindowTitle("Why Not?")
+	ebiten.SetWindowTitle(windowTitle(tabs[0].file))
 	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
 
-	var scale = ebiten.DeviceScaleFactor()
+	var scale = ebiten.DeviceScaleFactor() * tabs[0].zoom
+	faces := NewGoFontFaceSelector(72 * scale)
+	if *fontFile != "" {
+		src, err := os.ReadFile(*fontFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := faces.UseFont(src); err != nil {
+			log.Fatalf("%s: %s", *fontFile, err)
+		}
+	}
 
 	game := &whynotController{
 		ctx: RenderingContext{
 			Scale:        scale,
-			FaceSelector: NewGoFontFaceSelector(72 * scale),
+			FaceSelector: faces,
+			BaselineGrid: *baselineGrid,
+			Orphans:      2,
+			Widows:       2,
 		},
-		block: block,
+		document:    tabs[0],
+		tabs:        tabs,
+		tabStyle:    theme.tabStyle,
+		theme:       theme,
+		files:       files,
+		currentFile: fileIndex(files, tabs[0].file),
+		filesStyle:  theme.fileTreeStyle,
+		showFiles:   files != nil,
+		breadcrumbs: theme.breadcrumbStyle,
+		tocStyle:    theme.tocStyle,
+		showTOC:     *showTOC,
+		scrollStyle: theme.scrollbarStyle,
+		showMinimap: *showMinimap,
+
+		selectionColor: theme.selectionColor,
+		searchStyle:    theme.searchStyle,
+		slideStyle:     theme.slideStyle,
+	}
+	if *paged {
+		game.pageLayout = &theme.pageLayout
 	}
-	if err := ebiten.RunGame(game); err != nil {
+	if *present {
+		source, err := os.ReadFile(tabs[0].file)
+		if err != nil {
+			panic(err)
+		}
+		slides := parseSlides(source, filepath.Dir(tabs[0].file), theme)
+		game.presentation = &presentation{slides: slides}
+	}
+	err := ebiten.RunGame(game)
+	for _, doc := range game.tabs {
+		doc.keepZoom()
+	}
+	if err != nil {
 		log.Fatal(err)
 	}
 }
 
 type whynotController struct {
-	ctx     RenderingContext
-	block   Block
-	offsetY float64
+	ctx RenderingContext
+	box Box // as laid out for the last frame
+
+	// The documents open in tabs, and the one shown.  The bar of tabs is
+	// shown when there are several, or files to open.
+	*document
+	tabs     []*document
+	tab      int
+	tabStyle TabStyle
+	tabBar   *tabBar
+
+	// Documents are compiled with the theme, when opened and again when
+	// their file changes.
+	theme Theme
+
+	// The Markdown files that can be opened, if any, listed in a side
+	// panel scrolled separately from the document.
+	files        []fileEntry
+	currentFile  int // the index of the file shown, or -1
+	filesStyle   TOCStyle
+	showFiles    bool
+	fileTree     *fileTreePanel
+	filesOffsetY int
+
+	// The window is split into the file tree and the table of contents,
+	// if shown, the bar of tabs above the document, the document, its
+	// minimap, if shown, and its scrollbar.
+	docRect   image.Rectangle
+	filesRect image.Rectangle
+	tocRect   image.Rectangle
+	tabsRect  image.Rectangle
+	mapRect   image.Rectangle
+
+	// The scrollbar and minimap, and which of them is being dragged.  grab
+	// is where the thumb was grabbed.
+	scrollStyle ScrollbarStyle
+	scrollbar   scrollbar
+	showMinimap bool
+	minimap     minimap
+	dragging    dragTarget
+	grab        int
+
+	// The bar showing the headings above the top of the document.
+	breadcrumbs BreadcrumbStyle
+	bar         *breadcrumbBar
+
+	// The table of contents, scrolled separately from the document.  The
+	// current entry is scrolled into view when it changes.
+	tocStyle   TOCStyle
+	showTOC    bool
+	toc        *tocPanel
+	tocOffsetY int
+	tocCurrent int
+
+	// The headings of the document, as laid out for the last frame.
+	headings []headingPos
+
+	// The selected text, if any, and the selectable boxes as laid out for
+	// the last frame.  Selections are made by dragging or by clicking
+	// several times; clicks counts the clicks in a row.
+	runs           []textRun
+	selection      *selection
+	selectionColor color.Color
+	selecting      bool
+	clicks         int
+	lastClick      int
+	clickPos       image.Point
+	ticks          int
+
+	// The search bar, when it is open, and whether the current match
+	// should be scrolled into view.
+	search      *search
+	searchStyle SearchStyle
+	revealMatch bool
+
+	// In paged mode, the layout of pages and the page shown.  The pages
+	// are laid out again only when the document or the scale changes.
+	pageLayout *PageLayout
+	page       int
+	pages      []Box
+	pagesBlock Block
+	pagesScale float64
+
+	// Otherwise the layout of the document, which is done again only when
+	// the document, the width of the view or the scale changes.
+	boxBlock Block
+	boxWidth int
+	boxScale float64
+
+	// In presentation mode, the slides of the document instead.
+	presentation *presentation
+	slideStyle   SlideStyle
+}
+
+type dragTarget int
+
+const (
+	dragNone dragTarget = iota
+	dragThumb
+	dragMinimap
+)
+
+// Boxes that scroll horizontally implement this.
+type horizontalScroller interface {
+	ScrollBy(dx int)
 }
 
 func (c *whynotController) Update() error {
-	_, dy := ebiten.Wheel()
-	c.offsetY += dy * ebiten.DeviceScaleFactor()
+	if c.presentation != nil {
+		c.ticks++
+		c.watch()
+		c.presentKeys()
+		return nil
+	}
+	c.navigationKeys()
+	alt := ebiten.IsKeyPressed(ebiten.KeyAlt)
+	if c.pageLayout != nil && !alt {
+		switch {
+		case inpututil.IsKeyJustPressed(ebiten.KeyPageDown), inpututil.IsKeyJustPressed(ebiten.KeyArrowRight),
+			inpututil.IsKeyJustPressed(ebiten.KeySpace):
+			c.page++
+			c.scroll.jumpTo(0)
+		case inpututil.IsKeyJustPressed(ebiten.KeyPageUp), inpututil.IsKeyJustPressed(ebiten.KeyArrowLeft):
+			if c.page > 0 {
+				c.page--
+			}
+			c.scroll.jumpTo(0)
+		}
+	}
+	c.zoomKeys()
+	c.tabKeys()
+	// While the search bar is open, keys go to it.
+	typing := c.search != nil
+	if c.pageLayout == nil {
+		if typing {
+			c.searchKeys()
+		} else {
+			c.scrollKeys()
+			if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+				c.showTOC = !c.showTOC
+			}
+			if inpututil.IsKeyJustPressed(ebiten.KeyM) {
+				c.showMinimap = !c.showMinimap
+			}
+			if inpututil.IsKeyJustPressed(ebiten.KeyB) && c.files != nil {
+				c.showFiles = !c.showFiles
+			}
+		}
+		if control() && inpututil.IsKeyJustPressed(ebiten.KeyF) {
+			if c.search == nil {
+				c.search = &search{}
+			}
+		}
+	}
+	c.ticks++
+	c.watch()
+	cursor := image.Pt(ebiten.CursorPosition())
+	c.drag(cursor)
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		switch {
+		case c.bar != nil && cursor.In(c.bar.box.Bounds().Add(c.docRect.Min)):
+			if h, ok := c.bar.crumbAt(cursor.Sub(c.docRect.Min)); ok {
+				c.scrollTo(h)
+			}
+		case c.tabBar != nil && cursor.In(c.tabsRect):
+			if i, ok := c.tabBar.tabAt(cursor.Sub(c.tabsRect.Min)); ok {
+				c.selectTab(i)
+			}
+		case c.fileTree != nil && cursor.In(c.filesRect):
+			if file, ok := c.fileTree.fileAt(cursor.Sub(c.filesRect.Min)); ok {
+				c.openTab(file)
+			}
+		case c.toc != nil && cursor.In(c.tocRect):
+			if h, ok := c.toc.entryAt(cursor.Sub(c.tocRect.Min)); ok {
+				c.scrollTo(h)
+			}
+		case c.pageLayout == nil && cursor.In(c.docRect):
+			if link, ok := linkAt(c.runs, c.docPoint(cursor)); ok {
+				c.follow(link)
+			} else {
+				c.click(cursor)
+			}
+		}
+	}
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonMiddle) && c.tabBar != nil && cursor.In(c.tabsRect) {
+		if i, ok := c.tabBar.tabAt(cursor.Sub(c.tabsRect.Min)); ok {
+			c.closeTab(i)
+		}
+	}
+	shape := ebiten.CursorShapeDefault
+	if _, ok := linkAt(c.runs, c.docPoint(cursor)); ok && c.pageLayout == nil && cursor.In(c.docRect) {
+		shape = ebiten.CursorShapePointer
+	}
+	ebiten.SetCursorShape(shape)
+	c.extendSelection(cursor)
+	if !typing {
+		c.selectionKeys()
+	}
+	dx, dy := ebiten.Wheel()
+	if ebiten.IsKeyPressed(ebiten.KeyShift) {
+		dx, dy = dy, 0
+	}
+	s := ebiten.DeviceScaleFactor()
+	if c.toc != nil && cursor.In(c.tocRect) {
+		c.tocOffsetY = clampInt(c.tocOffsetY-int(dy*s), 0, maxInt(0, c.toc.height-c.tocRect.Dy()))
+		c.scroll.step()
+		return nil
+	}
+	if c.fileTree != nil && cursor.In(c.filesRect) {
+		c.filesOffsetY = clampInt(c.filesOffsetY-int(dy*s), 0, maxInt(0, c.fileTree.height-c.filesRect.Dy()))
+		c.scroll.step()
+		return nil
+	}
+	c.scroll.fling(dy * s * wheelImpulse)
+	if c.box != nil {
+		c.scroll.clamp(c.box.Bounds().Max.Y, c.docRect.Dy())
+	}
+	c.scroll.step()
+	if dx != 0 && c.box != nil {
+		p := cursor.Sub(c.docRect.Min)
+		path := boxPath(c.box, image.Pt(p.X, p.Y-int(c.scroll.offset)))
+		for i := len(path) - 1; i >= 0; i-- {
+			if scroller, ok := path[i].Box.(horizontalScroller); ok {
+				scroller.ScrollBy(int(-dx * s))
+				break
+			}
+		}
+	}
 	return nil
 }
 
+// The file is checked for changes every this many ticks.
+const watchTicks = 30
+
+// watch reloads the document if its file changed.  A version that can't be
+// read, e.g. while it is being saved, is skipped.
+func (c *whynotController) watch() {
+	if c.ticks%watchTicks != 0 {
+		return
+	}
+	info, err := os.Stat(c.file)
+	if err != nil || info.ModTime().Equal(c.modTime) {
+		return
+	}
+	c.modTime = info.ModTime()
+	source, err := os.ReadFile(c.file)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	if c.presentation != nil {
+		c.presentation.setSlides(parseSlides(source, filepath.Dir(c.file), c.theme))
+		return
+	}
+	block := parseMarkdown(source, filepath.Dir(c.file), c.theme)
+	if c.box != nil && c.pageLayout == nil {
+		if loc, ok := locate(boxAnchors(c.box, image.Point{}), c.readingLine()); ok {
+			c.reanchor = &loc
+		}
+	}
+	c.setBlock(block)
+}
+
+// setBlock replaces the document, and what depends on its layout.
+func (c *whynotController) setBlock(block Block) {
+	c.block = block
+	c.invalidate()
+}
+
+func (c *whynotController) invalidate() {
+	c.boxBlock = nil
+	c.selection, c.selecting = nil, false
+	if c.search != nil {
+		c.search.invalidate()
+	}
+	c.minimap.invalidate()
+}
+
+// resetView forgets what was laid out for the document shown before, when
+// another one is shown.
+func (c *whynotController) resetView() {
+	c.invalidate()
+	c.box, c.runs, c.headings, c.bar = nil, nil, nil, nil
+	c.tocOffsetY, c.tocCurrent = 0, -1
+	c.page = 0
+	c.currentFile = fileIndex(c.files, c.file)
+	ebiten.SetWindowTitle(windowTitle(c.file))
+}
+
+// presentKeys moves to the next slide with the right and down arrows, PgDn,
+// Space, Enter or a click, to the previous one with the left and up arrows,
+// PgUp, Backspace or a right click, and to the first or last one with Home
+// and End.  N shows the speaker notes.
+func (c *whynotController) presentKeys() {
+	p := c.presentation
+	switch {
+	case keyRepeated(ebiten.KeyArrowRight), keyRepeated(ebiten.KeyArrowDown), keyRepeated(ebiten.KeyPageDown),
+		keyRepeated(ebiten.KeySpace), keyRepeated(ebiten.KeyEnter), inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft):
+		p.step(1)
+	case keyRepeated(ebiten.KeyArrowLeft), keyRepeated(ebiten.KeyArrowUp), keyRepeated(ebiten.KeyPageUp),
+		keyRepeated(ebiten.KeyBackspace), inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonRight):
+		p.step(-1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyHome):
+		p.step(-len(p.slides))
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnd):
+		p.step(len(p.slides))
+	case inpututil.IsKeyJustPressed(ebiten.KeyN):
+		p.showNotes = !p.showNotes
+	}
+}
+
+// tabKeys switches to the next tab with Ctrl+Tab, to the previous one with
+// Ctrl+Shift+Tab, and closes the current one with Ctrl+W.
+func (c *whynotController) tabKeys() {
+	if !control() {
+		return
+	}
+	n := len(c.tabs)
+	switch {
+	case keyRepeated(ebiten.KeyTab) && ebiten.IsKeyPressed(ebiten.KeyShift):
+		c.selectTab((c.tab + n - 1) % n)
+	case keyRepeated(ebiten.KeyTab):
+		c.selectTab((c.tab + 1) % n)
+	case inpututil.IsKeyJustPressed(ebiten.KeyW):
+		c.closeTab(c.tab)
+	}
+}
+
+// selectTab shows the document of a tab, as it was left.
+func (c *whynotController) selectTab(i int) {
+	if i == c.tab {
+		return
+	}
+	c.keepZoom()
+	c.tab, c.document = i, c.tabs[i]
+	c.resetView()
+}
+
+// openTab shows the tab of a file, opening it in a new tab after the current
+// one if needed.
+func (c *whynotController) openTab(file string) {
+	for i, doc := range c.tabs {
+		if sameFile(doc.file, file) {
+			c.selectTab(i)
+			return
+		}
+	}
+	doc, err := openDocument(file, c.theme)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	c.tabs = append(c.tabs[:c.tab+1], append([]*document{doc}, c.tabs[c.tab+1:]...)...)
+	c.selectTab(c.tab + 1)
+}
+
+// closeTab closes a tab, unless it is the last one.
+func (c *whynotController) closeTab(i int) {
+	if len(c.tabs) == 1 {
+		return
+	}
+	c.tabs[i].keepZoom()
+	c.tabs = append(c.tabs[:i], c.tabs[i+1:]...)
+	switch {
+	case i < c.tab:
+		c.tab--
+	case i == c.tab:
+		c.tab = minInt(i, len(c.tabs)-1)
+		c.document = c.tabs[c.tab]
+		c.resetView()
+	}
+}
+
+// navigationKeys goes back and forward in the history with Alt+Left and
+// Alt+Right, or with the back and forward buttons of the mouse.
+func (c *whynotController) navigationKeys() {
+	backPressed := inpututil.IsMouseButtonJustPressed(ebiten.MouseButton3)
+	forwardPressed := inpututil.IsMouseButtonJustPressed(ebiten.MouseButton4)
+	if ebiten.IsKeyPressed(ebiten.KeyAlt) {
+		backPressed = backPressed || inpututil.IsKeyJustPressed(ebiten.KeyArrowLeft)
+		forwardPressed = forwardPressed || inpututil.IsKeyJustPressed(ebiten.KeyArrowRight)
+	}
+	switch {
+	case backPressed:
+		if v, ok := c.history.goBack(c.here()); ok {
+			if err := c.show(v); err != nil {
+				log.Print(err)
+				c.history.goForward(v)
+			}
+		}
+	case forwardPressed:
+		if v, ok := c.history.goForward(c.here()); ok {
+			if err := c.show(v); err != nil {
+				log.Print(err)
+				c.history.goBack(v)
+			}
+		}
+	}
+}
+
+// here returns the document shown and how far it is scrolled.
+func (c *whynotController) here() visit {
+	return visit{c.file, c.scroll.target}
+}
+
+// follow opens the document a link points to.  Only relative links to
+// Markdown documents are followed.
+func (c *whynotController) follow(link string) {
+	file, ok := resolveLink(c.file, link)
+	if !ok {
+		log.Printf("not following link to %s", link)
+		return
+	}
+	current := c.here()
+	if err := c.show(visit{file: file}); err != nil {
+		log.Print(err)
+		return
+	}
+	c.history.push(current)
+}
+
+// show replaces the document of the tab with another one, scrolled as it was
+// visited.  The tab keeps its history.
+func (c *whynotController) show(v visit) error {
+	doc, err := openDocument(v.file, c.theme)
+	if err != nil {
+		return err
+	}
+	c.keepZoom()
+	doc.history = c.history
+	doc.scroll.jumpTo(v.offset)
+	c.document, c.tabs[c.tab] = doc, doc
+	c.resetView()
+	return nil
+}
+
+// Distances scrolled, unscaled: by the arrow keys, and by the wheel per tick
+// for each unit it is rolled.
+const (
+	scrollLine   = 40
+	wheelImpulse = 6
+)
+
+// keyRepeated reports whether a key was just pressed or is held long enough
+// to repeat.
+func keyRepeated(key ebiten.Key) bool {
+	d := inpututil.KeyPressDuration(key)
+	return d == 1 || d >= 30 && d%4 == 0
+}
+
+// scrollKeys scrolls the document with the keyboard: by a line with the
+// arrows or j and k, by a page with PgUp, PgDn and Space, to either end with
+// Home, End, g and G, and to the previous or next heading with [ and ].
+func (c *whynotController) scrollKeys() {
+	line := scrollLine * c.ctx.Scale
+	page := float64(c.docRect.Dy()-c.barHeight()) - line
+	shift := ebiten.IsKeyPressed(ebiten.KeyShift)
+	switch {
+	case keyRepeated(ebiten.KeyArrowDown), keyRepeated(ebiten.KeyJ):
+		c.scroll.scrollBy(-line)
+	case keyRepeated(ebiten.KeyArrowUp), keyRepeated(ebiten.KeyK):
+		c.scroll.scrollBy(line)
+	case keyRepeated(ebiten.KeyPageDown), keyRepeated(ebiten.KeySpace) && !shift:
+		c.scroll.scrollBy(-page)
+	case keyRepeated(ebiten.KeyPageUp), keyRepeated(ebiten.KeySpace) && shift:
+		c.scroll.scrollBy(page)
+	case inpututil.IsKeyJustPressed(ebiten.KeyHome), inpututil.IsKeyJustPressed(ebiten.KeyG) && !shift:
+		c.scroll.scrollTo(0)
+	case inpututil.IsKeyJustPressed(ebiten.KeyEnd), inpututil.IsKeyJustPressed(ebiten.KeyG) && shift:
+		c.scroll.scrollTo(math.Inf(-1))
+	case keyRepeated(ebiten.KeyBracketRight):
+		y := c.barHeight() - int(c.scroll.target)
+		for _, h := range c.headings {
+			if h.pos.Y > y+1 {
+				c.scrollTo(h)
+				break
+			}
+		}
+	case keyRepeated(ebiten.KeyBracketLeft):
+		y := c.barHeight() - int(c.scroll.target)
+		for i := len(c.headings) - 1; i >= 0; i-- {
+			if h := c.headings[i]; h.pos.Y < y-1 {
+				c.scrollTo(h)
+				break
+			}
+		}
+	}
+}
+
+// Clicks this many ticks apart or less, and this close, are in a row.
+const (
+	multiClickTicks    = 30
+	multiClickDistance = 4
+)
+
+// docPoint returns the point of the document under a point of the window.
+func (c *whynotController) docPoint(p image.Point) image.Point {
+	return p.Sub(c.docRect.Min).Sub(image.Pt(0, int(c.scroll.offset)))
+}
+
+// click starts a selection: one click starts selecting by dragging, two
+// select a word and three a paragraph, or a line of code.
+func (c *whynotController) click(cursor image.Point) {
+	d := cursor.Sub(c.clickPos)
+	if c.ticks-c.lastClick <= multiClickTicks && d.X*d.X+d.Y*d.Y <= multiClickDistance*multiClickDistance {
+		c.clicks = c.clicks%3 + 1
+	} else {
+		c.clicks = 1
+	}
+	c.lastClick, c.clickPos = c.ticks, cursor
+	pos, ok := hitTest(c.runs, c.docPoint(cursor))
+	if !ok {
+		c.selection = nil
+		return
+	}
+	switch c.clicks {
+	case 1:
+		c.selection = &selection{anchor: pos, focus: pos}
+		c.selecting = true
+	case 2:
+		start, end := wordAt(c.runs, pos)
+		c.selection = &selection{anchor: start, focus: end}
+	case 3:
+		start, end := paragraphAt(c.runs, pos)
+		c.selection = &selection{anchor: start, focus: end}
+	}
+}
+
+// extendSelection moves the end of the selection to the cursor while the
+// mouse button is held, and scrolls when the cursor is past the top or the
+// bottom of the document.
+func (c *whynotController) extendSelection(cursor image.Point) {
+	if !c.selecting || c.selection == nil {
+		return
+	}
+	if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		c.selecting = false
+		return
+	}
+	edge := selectionScrollSpeed * c.ctx.Scale
+	switch {
+	case cursor.Y < c.docRect.Min.Y+c.barHeight():
+		c.scroll.scrollBy(edge)
+	case cursor.Y >= c.docRect.Max.Y:
+		c.scroll.scrollBy(-edge)
+	}
+	if pos, ok := hitTest(c.runs, c.docPoint(cursor)); ok {
+		c.selection.focus = pos
+	}
+}
+
+// How fast the document scrolls when selecting past its edges, unscaled.
+const selectionScrollSpeed = 8
+
+// selectionKeys copies the selection with Ctrl+C (or Cmd+C), selects all
+// the text with Ctrl+A and clears the selection with Escape.
+func (c *whynotController) selectionKeys() {
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+		c.selection = nil
+	}
+	if !control() {
+		return
+	}
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyA) && len(c.runs) > 0:
+		last := len(c.runs) - 1
+		c.selection = &selection{focus: textPos{last, len(c.runs[last].text)}}
+	case inpututil.IsKeyJustPressed(ebiten.KeyC) && c.selection != nil:
+		if err := writeClipboard(c.selection.text(c.runs)); err != nil {
+			log.Print(err)
+		}
+	}
+}
+
+// zoomKeys zooms in with Ctrl and plus, out with Ctrl and minus, and back to
+// the natural size with Ctrl+0.  The zoom level is remembered for the file
+// once the keys are released.
+func (c *whynotController) zoomKeys() {
+	if !zoomKeyHeld() {
+		c.keepZoom()
+	}
+	if !control() {
+		return
+	}
+	zoom := c.zoom
+	switch {
+	case keyRepeated(ebiten.KeyEqual), keyRepeated(ebiten.KeyNumpadAdd):
+		zoom = stepZoom(zoom, 1)
+	case keyRepeated(ebiten.KeyMinus), keyRepeated(ebiten.KeyNumpadSubtract):
+		zoom = stepZoom(zoom, -1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyDigit0), inpututil.IsKeyJustPressed(ebiten.KeyNumpad0):
+		zoom = 1
+	}
+	if zoom == c.zoom {
+		return
+	}
+	// Keep the same part of the document in view.  When paged, only the
+	// offset in the page is scaled.
+	ratio := zoom / c.zoom
+	if c.box != nil && c.pageLayout == nil {
+		if loc, ok := locate(boxAnchors(c.box, image.Point{}), c.readingLine()); ok {
+			c.reanchor = &loc
+		}
+	} else {
+		c.scroll.jumpTo(c.scroll.offset * ratio)
+	}
+	c.tocOffsetY = int(float64(c.tocOffsetY) * ratio)
+	c.zoom, c.zoomChanged = zoom, true
+}
+
+// zoomKeyHeld reports whether any of the keys changing the zoom level is
+// held.
+func zoomKeyHeld() bool {
+	for _, key := range []ebiten.Key{ebiten.KeyEqual, ebiten.KeyNumpadAdd, ebiten.KeyMinus,
+		ebiten.KeyNumpadSubtract, ebiten.KeyDigit0, ebiten.KeyNumpad0} {
+		if ebiten.IsKeyPressed(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// control reports whether Ctrl, or Cmd, is held.
+func control() bool {
+	return ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+}
+
+// searchKeys edits the query of the search bar.  Enter and Shift+Enter go to
+// the next and previous matches, Ctrl+R switches between literal text and
+// regular expressions, and Escape closes the bar.
+func (c *whynotController) searchKeys() {
+	s := c.search
+	switch {
+	case inpututil.IsKeyJustPressed(ebiten.KeyEscape):
+		c.search = nil
+		return
+	case keyRepeated(ebiten.KeyEnter):
+		s.next(ebiten.IsKeyPressed(ebiten.KeyShift))
+		c.revealMatch = true
+	case keyRepeated(ebiten.KeyBackspace) && s.query != "":
+		_, size := utf8.DecodeLastRuneInString(s.query)
+		s.query = s.query[:len(s.query)-size]
+	case control() && inpututil.IsKeyJustPressed(ebiten.KeyR):
+		s.regex = !s.regex
+	}
+	if control() {
+		return
+	}
+	for _, r := range ebiten.AppendInputChars(nil) {
+		if unicode.IsPrint(r) {
+			s.query += string(r)
+		}
+	}
+}
+
+// drag scrolls the document while the scrollbar thumb or the minimap is
+// dragged.  Pressing the track outside the thumb moves the thumb there.
+func (c *whynotController) drag(cursor image.Point) {
+	if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		c.dragging = dragNone
+		return
+	}
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		switch {
+		case cursor.In(c.scrollbar.thumb):
+			c.dragging, c.grab = dragThumb, cursor.Y-c.scrollbar.thumb.Min.Y
+		case cursor.In(c.scrollbar.track):
+			c.dragging, c.grab = dragThumb, c.scrollbar.thumb.Dy()/2
+		case cursor.In(c.mapRect):
+			c.dragging = dragMinimap
+		}
+	}
+	switch c.dragging {
+	case dragNone:
+		return
+	case dragThumb:
+		c.scroll.jumpTo(c.scrollbar.offsetAt(cursor.Y - c.grab))
+	case dragMinimap:
+		c.scroll.jumpTo(c.minimap.offsetAt(c.mapRect, cursor.Y, c.scroll.offset, c.docRect.Dy()))
+	}
+	if c.box != nil {
+		c.scroll.clamp(c.box.Bounds().Max.Y, c.docRect.Dy())
+	}
+}
+
 func (c *whynotController) Draw(screen *ebiten.Image) {
-	box := c.block.GetBox(c.ctx, screen.Bounds().Dx())
-	box.Draw(screen, 0, int(c.offsetY))
+	if c.presentation != nil {
+		c.presentation.Draw(screen, c.ctx, c.slideStyle)
+		return
+	}
+	if c.pageLayout != nil {
+		c.drawPage(screen)
+		return
+	}
+	c.docRect = screen.Bounds()
+	c.filesRect = image.Rectangle{}
+	c.tocRect = image.Rectangle{}
+	c.tabsRect = image.Rectangle{}
+	c.mapRect = image.Rectangle{}
+	if c.showFiles && c.files != nil {
+		width := minInt(int(c.filesStyle.Width*c.ctx.Scale), c.docRect.Dx()/3)
+		c.filesRect = image.Rect(c.docRect.Min.X, 0, c.docRect.Min.X+width, c.docRect.Dy())
+		c.docRect.Min.X += width
+	}
+	if c.showTOC {
+		width := minInt(int(c.tocStyle.Width*c.ctx.Scale), c.docRect.Dx()/2)
+		c.tocRect = image.Rect(c.docRect.Min.X, 0, c.docRect.Min.X+width, c.docRect.Dy())
+		c.docRect.Min.X += width
+	}
+	c.tabBar = nil
+	if len(c.tabs) > 1 || c.files != nil {
+		c.tabBar = newTabBar(c.ctx, c.tabStyle, c.tabs, c.tab, c.docRect.Dx())
+		c.tabsRect = c.docRect
+		c.tabsRect.Max.Y = c.tabsRect.Min.Y + c.tabBar.box.Bounds().Dy()
+		c.docRect.Min.Y = c.tabsRect.Max.Y
+	}
+	track := c.docRect
+	c.docRect.Max.X -= int(c.scrollStyle.Width * c.ctx.Scale)
+	track.Min.X = c.docRect.Max.X
+	if c.showMinimap {
+		c.mapRect = c.docRect
+		c.docRect.Max.X -= minInt(int(c.scrollStyle.MinimapWidth*c.ctx.Scale), c.docRect.Dx()/4)
+		c.mapRect.Min.X = c.docRect.Max.X
+	}
+
+	doc := screen.SubImage(c.docRect).(*ebiten.Image)
+	if c.box == nil || c.boxBlock != c.block || c.boxWidth != c.docRect.Dx() || c.boxScale != c.ctx.Scale {
+		c.box = c.block.Layout(c.ctx, Constraints{Width: c.docRect.Dx()})
+		c.runs = textRuns(c.box, image.Point{})
+		c.headings = boxHeadings(c.box, image.Point{})
+		c.boxBlock, c.boxWidth, c.boxScale = c.block, c.docRect.Dx(), c.ctx.Scale
+	}
+	height := c.box.Bounds().Max.Y
+	c.scroll.clamp(height, c.docRect.Dy())
+	if c.reanchor != nil {
+		if y, ok := c.reanchor.position(boxAnchors(c.box, image.Point{})); ok {
+			c.scroll.jumpTo(float64(c.barHeight() - y))
+			c.scroll.clamp(height, c.docRect.Dy())
+		}
+		c.reanchor = nil
+	}
+	for _, r := range c.runs {
+		r.box.clearMarks()
+	}
+	var searchBar Box
+	if c.search != nil {
+		if c.search.find(c.runs) {
+			pos, _ := hitTest(c.runs, image.Pt(0, c.readingLine()))
+			c.search.first(pos)
+			c.revealMatch = true
+		}
+		c.search.apply(c.runs, c.searchStyle)
+		searchBar = c.search.bar(c.ctx, c.searchStyle, c.docRect.Dx())
+		if c.revealMatch {
+			c.revealCurrentMatch(searchBar.Bounds().Dy())
+		}
+	}
+	if c.selection != nil {
+		c.selection.apply(c.runs, c.selectionColor)
+	}
+	c.box.Draw(doc, c.docRect.Min.X, c.docRect.Min.Y+int(c.scroll.offset))
+	headings := c.headings
+	c.drawBreadcrumbs(doc, headings)
+	if searchBar != nil {
+		searchBar.Draw(doc, c.docRect.Min.X, c.docRect.Max.Y-searchBar.Bounds().Dy())
+	}
+	if c.tabBar != nil {
+		c.tabBar.box.Draw(screen, c.tabsRect.Min.X, c.tabsRect.Min.Y)
+	}
+	c.fileTree = nil
+	if c.filesRect != (image.Rectangle{}) {
+		c.fileTree = newFileTreePanel(c.ctx, c.filesStyle, c.files, c.currentFile, c.filesRect.Size(), c.filesOffsetY)
+		c.fileTree.box.Draw(screen.SubImage(c.filesRect).(*ebiten.Image), c.filesRect.Min.X, c.filesRect.Min.Y)
+	}
+	c.toc = nil
+	if c.showTOC {
+		c.drawTOC(screen.SubImage(c.tocRect).(*ebiten.Image), headings)
+	}
+	if c.showMinimap {
+		c.minimap.update(c.box, c.mapRect.Dx())
+		c.minimap.Draw(screen.SubImage(c.mapRect).(*ebiten.Image), c.mapRect, c.scroll.offset, c.docRect.Dy(), c.scrollStyle)
+	}
+	c.scrollbar = newScrollbar(track, height, int(c.scrollStyle.MinThumb*c.ctx.Scale), c.scroll.offset)
+	c.scrollbar.Draw(screen, c.scrollStyle)
+}
+
+// revealCurrentMatch scrolls the current match of the search to the middle
+// of the document if it isn't in view above the search bar.
+func (c *whynotController) revealCurrentMatch(barHeight int) {
+	c.revealMatch = false
+	if len(c.search.matches) == 0 {
+		return
+	}
+	m := c.search.matches[c.search.current]
+	if m.start.run >= len(c.runs) {
+		return
+	}
+	rect := c.runs[m.start.run].rect
+	top := c.barHeight() - int(c.scroll.target)
+	bottom := c.docRect.Dy() - barHeight - int(c.scroll.target)
+	if rect.Min.Y < top || rect.Max.Y > bottom {
+		c.scroll.scrollTo(float64(c.docRect.Dy()/2 - rect.Min.Y))
+	}
+}
+
+// scrollTo scrolls the document so that a heading is just below the
+// breadcrumb bar.
+func (c *whynotController) scrollTo(h headingPos) {
+	bar := newBreadcrumbBar(c.ctx, c.breadcrumbs, []headingPos{h}, c.docRect.Dx())
+	c.scroll.scrollTo(float64(bar.box.Bounds().Dy() - h.pos.Y))
+}
+
+// barHeight returns the height of the breadcrumb bar, if it's shown.
+func (c *whynotController) barHeight() int {
+	if c.bar == nil {
+		return 0
+	}
+	return c.bar.box.Bounds().Dy()
+}
+
+// readingLine returns the top of the part of the document that isn't hidden
+// by the breadcrumb bar.
+func (c *whynotController) readingLine() int {
+	return c.barHeight() - int(c.scroll.offset)
+}
+
+// drawTOC draws the table of contents with the section being read
+// highlighted.
+func (c *whynotController) drawTOC(dst *ebiten.Image, headings []headingPos) {
+	current := currentHeading(headings, c.readingLine())
+	size := c.tocRect.Size()
+	toc := newTOCPanel(c.ctx, c.tocStyle, headings, current, size, c.tocOffsetY)
+	if current != c.tocCurrent && current >= 0 {
+		entry := toc.entries[current]
+		switch {
+		case entry.Min.Y < 0:
+			c.tocOffsetY += entry.Min.Y
+		case entry.Max.Y > size.Y:
+			c.tocOffsetY += entry.Max.Y - size.Y
+		}
+		toc = newTOCPanel(c.ctx, c.tocStyle, headings, current, size, c.tocOffsetY)
+	}
+	c.tocCurrent = current
+	c.toc = toc
+	toc.box.Draw(dst, c.tocRect.Min.X, c.tocRect.Min.Y)
+}
+
+// drawBreadcrumbs draws the path of headings leading to the top of the
+// document, over it, once a heading has been scrolled past.
+func (c *whynotController) drawBreadcrumbs(dst *ebiten.Image, headings []headingPos) {
+	path := headingPath(headings, -int(c.scroll.offset)-1)
+	if len(path) == 0 {
+		c.bar = nil
+		return
+	}
+	c.bar = newBreadcrumbBar(c.ctx, c.breadcrumbs, path, c.docRect.Dx())
+	c.bar.box.Draw(dst, c.docRect.Min.X, c.docRect.Min.Y)
+}
+
+// drawPage draws the current page, centered horizontally.
+func (c *whynotController) drawPage(screen *ebiten.Image) {
+	if c.pagesBlock != c.block || c.pagesScale != c.ctx.Scale {
+		c.pages = Paginate(c.ctx, c.block, *c.pageLayout)
+		c.pagesBlock, c.pagesScale = c.block, c.ctx.Scale
+	}
+	pages := c.pages
+	if len(pages) == 0 {
+		return
+	}
+	if c.page >= len(pages) {
+		c.page = len(pages) - 1
+	}
+	page := pages[c.page]
+	x := (screen.Bounds().Dx() - page.Bounds().Dx()) / 2
+	y := int(16 * c.ctx.Scale)
+	c.box = NewContainerBox(page, x+page.Bounds().Dx(), y+page.Bounds().Dy()+y, x, y)
+	c.docRect = screen.Bounds()
+	c.scroll.clamp(c.box.Bounds().Max.Y, c.docRect.Dy())
+	c.box.Draw(screen, 0, int(c.scroll.offset))
 }
 
 func (c *whynotController) Layout(outsideWidth, outsideHeight int) (int, int) {
 	s := ebiten.DeviceScaleFactor()
-	c.ctx.SetDPI(s * 72)
-	c.ctx.Scale = s
+	c.ctx.SetDPI(s * c.zoom * 72)
+	c.ctx.Scale = s * c.zoom
 	return int(float64(outsideWidth) * s), int(float64(outsideHeight) * s)
 }
@@ -1,92 +1,58 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"image/color"
 	_ "image/jpeg"
 	"log"
+	"strconv"
 	"strings"
 
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/yuin/goldmark"
 	gmast "github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
 	gmtext "github.com/yuin/goldmark/text"
 	"golang.org/x/image/font"
 )
 
-func parseMarkdown(source []byte) Block {
-	parser := goldmark.DefaultParser()
-	reader := gmtext.NewReader(source)
-	node := parser.Parse(reader)
-	node.Dump(source, 2)
+// parseMarkdown compiles a document of a directory.  Markdown that can't be
+// shown yet is replaced with a placeholder.
+func parseMarkdown(source []byte, dir string, theme Theme) Block {
 	compiler := MarkdownCompiler{
 		source: source,
-		paragraphStyle: partStyle{
-			TextStyle: TextStyle{Size: 16},
-			Margins:   Margins{Top: 10, Bottom: 10},
-		},
-		listItemStyle: partStyle{
-			TextStyle: TextStyle{Size: 16},
-			Margins:   Margins{Top: 5, Bottom: 5, Left: 40},
-		},
-		listStyle: partStyle{
-			Margins: Margins{Top: 10, Bottom: 10},
-		},
-		headingStyles: [6]partStyle{
-			{
-				TextStyle:   TextStyle{Size: 40, Weight: font.WeightBold, Family: SmallCaps},
-				Margins:     Margins{Top: 30, Bottom: 10},
-				LevelOffset: 2,
-			},
-			{
-				TextStyle:   TextStyle{Size: 36, Weight: font.WeightBold},
-				Margins:     Margins{Top: 26, Bottom: 10},
-				LevelOffset: 2,
-			},
-			{
-				TextStyle:   TextStyle{Size: 32, Weight: font.WeightBold},
-				Margins:     Margins{Top: 22, Bottom: 10},
-				LevelOffset: 2,
-			},
-			{
-				TextStyle:   TextStyle{Size: 28, Weight: font.WeightBold},
-				Margins:     Margins{Top: 18, Bottom: 10},
-				LevelOffset: 2,
-			},
-			{
-				TextStyle:   TextStyle{Size: 24, Weight: font.WeightBold},
-				Margins:     Margins{Top: 14, Bottom: 10},
-				LevelOffset: 2,
-			},
-			{
-				TextStyle:   TextStyle{Size: 20, Weight: font.WeightBold},
-				Margins:     Margins{Top: 10, Bottom: 10},
-				LevelOffset: 2,
-			},
-		},
-		codeBlockStyle: partStyle{
-			TextStyle: TextStyle{Size: 16, Family: Monospace},
-			Margins:   Margins{Top: 20, Bottom: 20, Left: 20},
-		},
-		codeColor: color.RGBA{0xFF, 0xFF, 0x80, 0xFF},
+		dir:    dir,
+		Theme:  theme,
 	}
-	return compiler.CompileDocument(node)
+	return compiler.CompileDocument(parseMarkdownTree(source))
+}
+
+func parseMarkdownTree(source []byte) gmast.Node {
+	p := goldmark.DefaultParser()
+	p.AddOptions(parser.WithAttribute())
+	return p.Parse(gmtext.NewReader(source))
 }
 
 type MarkdownCompiler struct {
-	source         []byte
-	headingStyles  [6]partStyle
-	paragraphStyle partStyle
-	listItemStyle  partStyle
-	listStyle      partStyle
-	codeBlockStyle partStyle
-	codeColor      color.Color
+	source []byte
+	dir    string // relative images are found in it
+	Theme
+
+	// Floating images taken out of the paragraph being compiled, to be put
+	// before it.
+	floats []Block
+
+	// The text of the HTML comments compiled, the notes of slides.
+	notes []string
 }
 
-type partStyle struct {
-	TextStyle
-	Margins
-	LevelOffset int
+// unsupported warns about Markdown that can't be shown yet, and returns the
+// placeholder text shown instead.
+func (c *MarkdownCompiler) unsupported(format string, args ...interface{}) string {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("warning: %s", msg)
+	return "[" + msg + "]"
 }
 
 func (c *MarkdownCompiler) CompileNode(node gmast.Node) Block {
@@ -94,19 +60,78 @@ func (c *MarkdownCompiler) CompileNode(node gmast.Node) Block {
 	case gmast.TypeDocument:
 		return c.CompileDocument(node)
 	case gmast.TypeBlock:
-		return c.CompileBlock(node)
+		return c.withSourceLine(c.CompileBlock(node), node)
 	}
 	return nil
 }
 
+// withSourceLine records in a block the line of the source its node starts
+// on: that of its first line of text, or of its first descendant with one.
+func (c *MarkdownCompiler) withSourceLine(block Block, node gmast.Node) Block {
+	b, ok := block.(interface{ setSourceLine(int) })
+	if !ok {
+		return block
+	}
+	for n := node; n != nil && n.Type() == gmast.TypeBlock; n = n.FirstChild() {
+		if n.Lines().Len() > 0 {
+			b.setSourceLine(bytes.Count(c.source[:n.Lines().At(0).Start], []byte("\n")) + 1)
+			break
+		}
+	}
+	return block
+}
+
 func (c *MarkdownCompiler) CompileDocument(node gmast.Node) Block {
+	var nodes []gmast.Node
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		nodes = append(nodes, child)
+	}
+	blocks := c.CompileSection(nodes)
+	if c.columns > 1 {
+		blocks = []Block{&ColumnsBlock{blocks: blocks, columns: c.columns, gap: c.columnGap}}
+	}
+	return &StackBlock{blocks: blocks, measure: c.measure}
+}
+
+// CompileSection compiles a sequence of block nodes.  Nodes that aren't shown,
+// such as HTML, are left out.  The content of a
+// heading with a columns attribute, e.g.
+//
+//	## Release notes {columns=2}
+//
+// up to the next heading of the same or a higher level, is laid out in
+// columns.
+func (c *MarkdownCompiler) CompileSection(nodes []gmast.Node) []Block {
 	var blocks []Block
-	child := node.FirstChild()
-	for child != nil {
-		blocks = append(blocks, c.CompileNode(child))
-		child = child.NextSibling()
+	for i := 0; i < len(nodes); i++ {
+		block := c.CompileNode(nodes[i])
+		blocks = append(blocks, c.takeFloats()...)
+		if block != nil {
+			blocks = append(blocks, block)
+		}
+		heading, ok := nodes[i].(*gmast.Heading)
+		if !ok {
+			continue
+		}
+		columns, _ := attrFloat(nodeAttributes(heading), "columns")
+		if columns < 2 {
+			continue
+		}
+		end := i + 1
+		for end < len(nodes) {
+			if h, ok := nodes[end].(*gmast.Heading); ok && h.Level <= heading.Level {
+				break
+			}
+			end++
+		}
+		blocks = append(blocks, &ColumnsBlock{
+			blocks:  c.CompileSection(nodes[i+1 : end]),
+			columns: int(columns),
+			gap:     c.columnGap,
+		})
+		i = end - 1
 	}
-	return &StackBlock{blocks: blocks}
+	return blocks
 }
 
 func (c *MarkdownCompiler) CompileBlock(node gmast.Node) Block {
@@ -118,44 +143,315 @@ func (c *MarkdownCompiler) CompileBlock(node gmast.Node) Block {
 			items = c.AppendInlineNode(items, child, 0, c.paragraphStyle.Size)
 			child = child.NextSibling()
 		}
-		return &TextBlock{parts: items, margins: c.paragraphStyle.Margins}
+		items = c.extractFloats(items)
+		if len(items) == 0 {
+			if len(c.floats) == 0 {
+				// Nothing to show, e.g. an image that couldn't be
+				// loaded and has no alt text.
+				return nil
+			}
+			// The paragraph only has floats.
+			last := c.floats[len(c.floats)-1]
+			c.floats = c.floats[:len(c.floats)-1]
+			return last
+		}
+		if len(items) == 1 {
+			if img, ok := items[0].(*InlineImage); ok {
+				return c.CompileFigure(img)
+			}
+		}
+		level := resolveBidiLevels(items)
+		return &TextBlock{
+			parts:      items,
+			margins:    directedMargins(c.paragraphStyle.Margins, level),
+			level:      level,
+			lineHeight: c.paragraphStyle.LineHeight,
+		}
 	case gmast.KindHeading:
 		var items []Inline
-		partStyle := c.headingStyles[node.(*gmast.Heading).Level-1]
+		headingLevel := node.(*gmast.Heading).Level
+		partStyle := c.headingStyles[headingLevel-1]
 		child := node.FirstChild()
 		for child != nil {
 			items = c.AppendInlineNode(items, child, 2, partStyle.Size)
 			child = child.NextSibling()
 		}
-		return &TextBlock{parts: items, margins: partStyle.Margins}
+		level := resolveBidiLevels(items)
+		return &TextBlock{
+			parts:        items,
+			margins:      directedMargins(partStyle.Margins, level),
+			level:        level,
+			lineHeight:   partStyle.LineHeight,
+			headingLevel: headingLevel,
+			spanColumns:  c.spanHeadings,
+		}
 	case gmast.KindList:
 		list := node.(*gmast.List)
 		var items []Block
 		var index = 1
 		child := node.FirstChild()
 		for child != nil {
-			items = append(items, c.CompileListItem(child, index, list.Marker))
+			items = append(items, c.withSourceLine(c.CompileListItem(child, index, list.Marker), child))
 			child = child.NextSibling()
 			index++
 		}
 		return &StackBlock{blocks: items, margins: c.listStyle.Margins}
 	case gmast.KindFencedCodeBlock:
-		lineCount := node.Lines().Len()
-		items := make([]Inline, lineCount)
-		for i := 0; i < lineCount; i++ {
-			line := node.Lines().At(i)
-			items[i] = &InlineText{
-				text:  string(line.Value(c.source)),
+		codeBlock := node.(*gmast.FencedCodeBlock)
+		lines := make([]string, codeBlock.Lines().Len())
+		sources := make([]*sourceLine, len(lines))
+		for i := range lines {
+			line := codeBlock.Lines().At(i)
+			text := strings.TrimRight(string(line.Value(c.source)), "\r\n")
+			lines[i] = expandTabs(text, c.tabWidth)
+			sources[i] = &sourceLine{text, c.tabWidth}
+		}
+		items := c.highlightCode(lines, string(codeBlock.Language(c.source)))
+		for i, item := range items {
+			if spans, ok := item.(*InlineSpans); ok {
+				spans.source = sources[i]
+			}
+		}
+		block := &CodeBlock{
+			margins:    c.codeBlockStyle.Margins,
+			lines:      items,
+			lineHeight: c.codeBlockStyle.LineHeight,
+			decoration: c.codeBlockStyle.Decoration,
+			breakout:   c.codeBlockBreakout,
+			wrap:       c.codeWrap,
+			wrapMarker: &InlineText{
+				text:  "→",
+				style: c.codeBlockStyle.TextStyle,
+				color: c.lineNumberColor,
+			},
+			highlightColor: c.highlightColor,
+		}
+		if attrs, ok := c.codeBlockAttributes(codeBlock); ok {
+			c.applyCodeBlockAttributes(block, attrs)
+		}
+		return block
+	case gmast.KindBlockquote:
+		var blocks []Block
+		child := node.FirstChild()
+		for child != nil {
+			block := c.CompileNode(child)
+			blocks = append(blocks, c.takeFloats()...)
+			if block != nil {
+				blocks = append(blocks, block)
+			}
+			child = child.NextSibling()
+		}
+		return &StackBlock{
+			blocks:     blocks,
+			margins:    c.quoteStyle.Margins,
+			decoration: c.quoteStyle.Decoration,
+		}
+	case gmast.KindThematicBreak:
+		return &RuleBlock{margins: c.ruleStyle.Margins, color: c.ruleColor}
+	case gmast.KindHTMLBlock:
+		// HTML isn't shown.  Comments are the notes of slides.
+		html := node.(*gmast.HTMLBlock)
+		var text bytes.Buffer
+		lines := html.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			line := lines.At(i)
+			text.Write(line.Value(c.source))
+		}
+		if html.HasClosure() {
+			text.Write(html.ClosureLine.Value(c.source))
+		}
+		c.addNote(text.String())
+		return nil
+	}
+	text := c.unsupported("unsupported block %s", node.Kind())
+	return &TextBlock{
+		parts:      appendString(nil, text, getStyle(0, c.paragraphStyle.Size), c.codeColor),
+		margins:    c.paragraphStyle.Margins,
+		lineHeight: c.paragraphStyle.LineHeight,
+	}
+}
+
+// highlightCode returns the lines of a code block as spans colored by syntax,
+// or in the plain code color if the language isn't known.
+func (c *MarkdownCompiler) highlightCode(lines []string, lang string) []Inline {
+	items := make([]Inline, len(lines))
+	highlighter := lookupSyntax(lang)
+	if highlighter == nil {
+		for i, line := range lines {
+			items[i] = &InlineSpans{spans: []*InlineText{{
+				text:  line,
 				style: c.codeBlockStyle.TextStyle,
 				color: c.codeColor,
+			}}}
+		}
+		return items
+	}
+	for i, tokens := range highlighter.highlight(lines) {
+		line := &InlineSpans{}
+		for _, t := range tokens {
+			if t.text == "" {
+				continue
 			}
+			line.spans = append(line.spans, &InlineText{
+				text:  t.text,
+				style: c.codeBlockStyle.TextStyle,
+				color: c.syntaxPalette.color(t.kind, c.codeColor),
+			})
 		}
-		return &CodeBlock{
-			margins: c.codeBlockStyle.Margins,
-			lines:   items,
+		if line.spans == nil {
+			line.spans = []*InlineText{{style: c.codeBlockStyle.TextStyle, color: c.codeColor}}
 		}
+		items[i] = line
+	}
+	return items
+}
+
+// codeBlockAttributes returns the attributes in braces that follow the
+// language in the info string of a fenced code block, e.g.
+//
+//	```go {linenos=true hl_lines="3-5"}
+func (c *MarkdownCompiler) codeBlockAttributes(node *gmast.FencedCodeBlock) (parser.Attributes, bool) {
+	if node.Info == nil {
+		return nil, false
+	}
+	info := node.Info.Segment.Value(c.source)
+	i := bytes.IndexByte(info, '{')
+	if i < 0 {
+		return nil, false
 	}
-	panic("Unsupported block")
+	attrs, _, ok := parseAttributes(info[i:])
+	return attrs, ok
+}
+
+func (c *MarkdownCompiler) applyCodeBlockAttributes(block *CodeBlock, attrs parser.Attributes) {
+	first := 1
+	if start, ok := attrFloat(attrs, "linenostart"); ok {
+		first = int(start)
+	}
+	if linenos, ok := attrString(attrs, "linenos"); ok && linenos != "false" {
+		block.lineNumbers = make([]Inline, len(block.lines))
+		for i := range block.lineNumbers {
+			block.lineNumbers[i] = &InlineText{
+				text:  strconv.Itoa(first + i),
+				style: c.codeBlockStyle.TextStyle,
+				color: c.lineNumberColor,
+			}
+		}
+	}
+	if hlLines, ok := attrString(attrs, "hl_lines"); ok {
+		block.highlighted = parseLineRanges(hlLines, first, len(block.lines))
+	}
+}
+
+// A sourceLine is a line of code as written, before its tabs were expanded.
+type sourceLine struct {
+	text     string
+	tabWidth int
+}
+
+// slice returns the runes of the line that the runes from start to end of
+// the expanded line come from.  Tabs are kept whole.
+func (l *sourceLine) slice(start, end int) string {
+	if end <= start {
+		return ""
+	}
+	var sb strings.Builder
+	col := 0
+	for _, r := range l.text {
+		width := 1
+		if r == '\t' && l.tabWidth > 0 {
+			width = l.tabWidth - col%l.tabWidth
+		}
+		if col < end && col+width > start {
+			sb.WriteRune(r)
+		}
+		col += width
+	}
+	return sb.String()
+}
+
+// expandTabs replaces tabs with spaces up to the next tab stop.
+func expandTabs(s string, tabWidth int) string {
+	if tabWidth <= 0 || !strings.Contains(s, "\t") {
+		return s
+	}
+	var sb strings.Builder
+	col := 0
+	for _, r := range s {
+		if r == '\t' {
+			n := tabWidth - col%tabWidth
+			sb.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		sb.WriteRune(r)
+		col++
+	}
+	return sb.String()
+}
+
+// extractFloats moves floating images out of the inline items into floats.
+func (c *MarkdownCompiler) extractFloats(items []Inline) []Inline {
+	kept := items[:0]
+	for _, item := range items {
+		if img, ok := item.(*InlineImage); ok && img.float != FloatNone {
+			c.floats = append(c.floats, &FloatBlock{
+				margins:  c.floatStyle.Margins,
+				image:    img,
+				side:     img.float,
+				maxWidth: c.floatMaxWidth,
+			})
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// addNote keeps the text of a piece of HTML if it is a comment.
+func (c *MarkdownCompiler) addNote(html string) {
+	html = strings.TrimSpace(html)
+	if !strings.HasPrefix(html, "<!--") {
+		return
+	}
+	note := strings.TrimPrefix(html, "<!--")
+	if i := strings.Index(note, "-->"); i >= 0 {
+		note = note[:i]
+	}
+	if note = strings.TrimSpace(note); note != "" {
+		c.notes = append(c.notes, note)
+	}
+}
+
+func (c *MarkdownCompiler) takeNotes() []string {
+	notes := c.notes
+	c.notes = nil
+	return notes
+}
+
+func (c *MarkdownCompiler) takeFloats() []Block {
+	floats := c.floats
+	c.floats = nil
+	return floats
+}
+
+func (c *MarkdownCompiler) CompileFigure(img *InlineImage) Block {
+	figure := &FigureBlock{
+		margins:    c.figureStyle.Margins,
+		image:      img,
+		captionGap: c.captionStyle.Top,
+	}
+	if img.title != "" {
+		items := appendString(nil, img.title, c.captionStyle.TextStyle, c.captionColor)
+		level := resolveBidiLevels(items)
+		figure.caption = &TextBlock{
+			parts:      items,
+			level:      level,
+			lineHeight: c.captionStyle.LineHeight,
+			align:      AlignCenter,
+		}
+	}
+	return figure
 }
 
 func (c *MarkdownCompiler) CompileListItem(node gmast.Node, index int, marker byte) Block {
@@ -169,22 +465,32 @@ func (c *MarkdownCompiler) CompileListItem(node gmast.Node, index int, marker by
 	case '.':
 		markerString = fmt.Sprintf("%d.", index)
 	default:
-		panic("Unsupported marker")
+		markerString = c.unsupported("unsupported list marker %q", marker)
 	}
 
+	// An empty item has no contents.
 	contents := node.FirstChild()
-	switch contents.Kind() {
-	case gmast.KindTextBlock:
+	switch {
+	case contents == nil:
+	case contents.Kind() == gmast.KindTextBlock:
 		child := contents.FirstChild()
 		for child != nil {
 			items = c.AppendInlineNode(items, child, 0, c.listItemStyle.Size)
 			child = child.NextSibling()
 		}
 	default:
-		log.Panicf("Unuspported node kind: %s", contents.Kind())
+		text := c.unsupported("unsupported list item content %s", contents.Kind())
+		items = appendString(items, text, getStyle(0, c.listItemStyle.Size), c.codeColor)
 	}
 
-	return &ListItemBlock{parts: items, margins: c.listItemStyle.Margins, marker: &InlineText{text: markerString, color: color.White, style: c.listItemStyle.TextStyle}}
+	level := resolveBidiLevels(items)
+	return &ListItemBlock{
+		parts:      items,
+		margins:    directedMargins(c.listItemStyle.Margins, level),
+		marker:     &InlineText{text: markerString, color: color.White, style: c.listItemStyle.TextStyle},
+		level:      level,
+		lineHeight: c.listItemStyle.LineHeight,
+	}
 }
 
 func (c *MarkdownCompiler) AppendInlineNode(items []Inline, node gmast.Node, baseLevel int, size float64) []Inline {
@@ -192,7 +498,16 @@ func (c *MarkdownCompiler) AppendInlineNode(items []Inline, node gmast.Node, bas
 	case gmast.KindString:
 		return appendString(items, string(node.(*gmast.String).Value), getStyle(baseLevel, size), color.White)
 	case gmast.KindText:
-		return appendString(items, string(node.Text(c.source)), getStyle(baseLevel, size), color.White)
+		text := node.Text(c.source)
+		if prev := node.PreviousSibling(); prev != nil && prev.Kind() == gmast.KindImage && len(items) > 0 {
+			if img, ok := items[len(items)-1].(*InlineImage); ok {
+				var attrs parser.Attributes
+				if attrs, text, ok = parseAttributes(text); ok {
+					applyImageAttributes(img, attrs)
+				}
+			}
+		}
+		return appendString(items, string(text), getStyle(baseLevel, size), color.White)
 	case gmast.KindEmphasis:
 		child := node.FirstChild()
 		baseLevel += node.(*gmast.Emphasis).Level
@@ -207,15 +522,53 @@ func (c *MarkdownCompiler) AppendInlineNode(items []Inline, node gmast.Node, bas
 		return appendString(items, string(node.Text(c.source)), style, c.codeColor)
 	case gmast.KindImage:
 		imgNode := node.(*gmast.Image)
-		img, _, _ := ebitenutil.NewImageFromFile(string(imgNode.Destination))
+		img, _, err := ebitenutil.NewImageFromFile(resolveImage(c.dir, string(imgNode.Destination)))
+		if err != nil {
+			log.Printf("Could not load image: %s", err)
+			return appendString(items, string(imgNode.Text(c.source)), getStyle(baseLevel, size), color.White)
+		}
 		return append(items, &InlineImage{
 			image: img,
 			title: string(imgNode.Title),
+			src:   string(imgNode.Destination),
+			style: getStyle(baseLevel, size),
 		})
+	case gmast.KindLink:
+		start := len(items)
+		for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+			items = c.AppendInlineNode(items, child, baseLevel, size)
+		}
+		c.setLink(items[start:], string(node.(*gmast.Link).Destination))
+		return items
+	case gmast.KindAutoLink:
+		link := node.(*gmast.AutoLink)
+		start := len(items)
+		items = appendString(items, string(link.Label(c.source)), getStyle(baseLevel, size), color.White)
+		c.setLink(items[start:], string(link.URL(c.source)))
+		return items
+	case gmast.KindRawHTML:
+		var text bytes.Buffer
+		segments := node.(*gmast.RawHTML).Segments
+		for i := 0; i < segments.Len(); i++ {
+			segment := segments.At(i)
+			text.Write(segment.Value(c.source))
+		}
+		c.addNote(text.String())
+		return items
 	default:
-		log.Panicf("Unsupported node kind %s", node.Kind())
+		text := c.unsupported("unsupported inline %s", node.Kind())
+		return appendString(items, text, getStyle(baseLevel, size), c.codeColor)
+	}
+}
+
+// setLink makes the text of inline items part of a link.
+func (c *MarkdownCompiler) setLink(items []Inline, destination string) {
+	for _, item := range items {
+		if t, ok := item.(*InlineText); ok {
+			t.link = destination
+			t.color = c.linkColor
+		}
 	}
-	return nil
 }
 
 var levelToStyles = [4]TextStyle{
@@ -231,6 +584,23 @@ func getStyle(level int, size float64) TextStyle {
 	return textStyle
 }
 
+func applyImageAttributes(img *InlineImage, attrs parser.Attributes) {
+	img.width, _ = attrFloat(attrs, "width")
+	img.height, _ = attrFloat(attrs, "height")
+	switch align, _ := attrString(attrs, "align"); align {
+	case "middle":
+		img.align = AlignMiddle
+	case "top":
+		img.align = AlignTop
+	}
+	switch {
+	case attrHasClass(attrs, "float-left"):
+		img.float = FloatLeft
+	case attrHasClass(attrs, "float-right"):
+		img.float = FloatRight
+	}
+}
+
 func appendString(items []Inline, s string, style TextStyle, color color.Color) []Inline {
 	textParts := strings.Fields(s)
 	for _, part := range textParts {
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSourceLineSlice(t *testing.T) {
+	// With tabs every 4 columns, "a\tb\tc" is "a   b   c".
+	l := &sourceLine{text: "a\tb\tc", tabWidth: 4}
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{0, 9, "a\tb\tc"},
+		{0, 1, "a"},
+		{0, 2, "a\t"},
+		{2, 3, "\t"},
+		{1, 5, "\tb"},
+		{4, 9, "b\tc"},
+		{8, 9, "c"},
+		{8, 20, "c"},
+		{5, 5, ""},
+		{6, 2, ""},
+	}
+	for _, test := range tests {
+		if got := l.slice(test.start, test.end); got != test.want {
+			t.Errorf("slice(%d, %d) = %q, want %q", test.start, test.end, got, test.want)
+		}
+	}
+	runes := &sourceLine{text: "é\tü", tabWidth: 0}
+	if got := runes.slice(1, 3); got != "\tü" {
+		t.Errorf("slice without tab stops = %q, want %q", got, "\tü")
+	}
+}
+
+func TestExpandTabs(t *testing.T) {
+	tests := []struct {
+		s        string
+		tabWidth int
+		want     string
+	}{
+		{"a\tb", 4, "a   b"},
+		{"\t\tx", 2, "    x"},
+		{"abcd\te", 4, "abcd    e"},
+		{"a\tb", 0, "a\tb"},
+		{"plain", 8, "plain"},
+	}
+	for _, test := range tests {
+		if got := expandTabs(test.s, test.tabWidth); got != test.want {
+			t.Errorf("expandTabs(%q, %d) = %q, want %q", test.s, test.tabWidth, got, test.want)
+		}
+	}
+}
+
+func TestParseMarkdownSourceLines(t *testing.T) {
+	source := "# Title\n\nSome text\non two lines.\n\n- one\n- two\n"
+	doc := parseMarkdown([]byte(source), ".", DefaultTheme()).(*StackBlock)
+	var got []int
+	for _, b := range doc.blocks {
+		got = append(got, b.(sourceLined).SourceLine())
+	}
+	want := []int{1, 3, 6}
+	if len(got) != len(want) {
+		t.Fatalf("got blocks on lines %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got blocks on lines %v, want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestParseMarkdownUnsupported(t *testing.T) {
+	// Indented code blocks aren't supported yet.  They are shown as a
+	// placeholder, and the rest of the document still is.
+	source := "Before\n\n    indented code\n\nAfter\n"
+	doc := parseMarkdown([]byte(source), ".", DefaultTheme()).(*StackBlock)
+	if len(doc.blocks) != 3 {
+		t.Fatalf("got %d blocks, want 3", len(doc.blocks))
+	}
+	placeholder, ok := doc.blocks[1].(*TextBlock)
+	if !ok || len(placeholder.parts) == 0 {
+		t.Fatalf("got %#v, want a placeholder paragraph", doc.blocks[1])
+	}
+	var text strings.Builder
+	for _, part := range placeholder.parts {
+		if t, ok := part.(*InlineText); ok {
+			text.WriteString(t.text)
+		}
+	}
+	if !strings.Contains(text.String(), "CodeBlock") {
+		t.Errorf("placeholder text = %q, want it to name the block", text.String())
+	}
+	if line := placeholder.SourceLine(); line != 3 {
+		t.Errorf("placeholder on line %d, want 3", line)
+	}
+}
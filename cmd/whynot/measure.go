@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type LengthUnit int
+
+const (
+	Pixels LengthUnit = iota
+	Ems
+)
+
+// A Length is an unscaled distance, either in pixels or in ems of the body
+// text.
+type Length struct {
+	Value float64
+	Unit  LengthUnit
+}
+
+// ParseLength parses lengths such as "640", "640px" or "40em".
+func ParseLength(s string) (Length, error) {
+	text := s
+	s = strings.TrimSpace(s)
+	unit := Pixels
+	switch {
+	case strings.HasSuffix(s, "em"):
+		unit = Ems
+		s = strings.TrimSuffix(s, "em")
+	case strings.HasSuffix(s, "px"):
+		s = strings.TrimSuffix(s, "px")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return Length{}, fmt.Errorf("invalid length %q", text)
+	}
+	return Length{Value: v, Unit: unit}, nil
+}
+
+func (l Length) String() string {
+	unit := "px"
+	if l.Unit == Ems {
+		unit = "em"
+	}
+	return strconv.FormatFloat(l.Value, 'f', -1, 64) + unit
+}
+
+// Set and String make a Length usable as a flag.Value.
+func (l *Length) Set(s string) error {
+	v, err := ParseLength(s)
+	if err != nil {
+		return err
+	}
+	*l = v
+	return nil
+}
+
+// A Measure limits the width of a column of text, which is centered in the
+// available width.  A zero MaxWidth means no limit.  Blocks that break out
+// (e.g. wide code blocks) may use up to BreakoutWidth instead.
+type Measure struct {
+	MaxWidth      Length
+	BreakoutWidth Length
+
+	// The size of an em, in unscaled pixels.
+	EmSize float64
+}
+
+func (c RenderingContext) ScaleLength(l Length, emSize float64) float64 {
+	if l.Unit == Ems {
+		return l.Value * emSize * c.Scale
+	}
+	return l.Value * c.Scale
+}
+
+// column returns the width and left offset of a column of at most the given
+// length, centered in width.
+func (m Measure) column(ctx RenderingContext, l Length, width int) (int, int) {
+	if l.Value <= 0 {
+		return width, 0
+	}
+	w := int(ctx.ScaleLength(l, m.EmSize))
+	if w >= width {
+		return width, 0
+	}
+	return w, (width - w) / 2
+}
+
+// Blocks that may be wider than the measure implement this.
+type breakoutBlock interface {
+	Breakout() bool
+}
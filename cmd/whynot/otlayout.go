@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// This file reads the parts of the OpenType GSUB and GPOS tables that the
+// text shaper uses: single and ligature substitutions (GSUB lookup types 1
+// and 4), pair kerning and mark to base attachment (GPOS lookup types 2 and
+// 4).  Fonts with only a kern table are kerned by sfnt.Font.Kern.
+//
+// See https://learn.microsoft.com/en-us/typography/opentype/spec/chapter2
+
+func makeTag(s string) uint32 {
+	return binary.BigEndian.Uint32([]byte(s))
+}
+
+var (
+	tagGSUB = makeTag("GSUB")
+	tagGPOS = makeTag("GPOS")
+	tagDFLT = makeTag("DFLT")
+	tagLatn = makeTag("latn")
+	tagArab = makeTag("arab")
+	tagHebr = makeTag("hebr")
+	tagKern = makeTag("kern")
+	tagMark = makeTag("mark")
+)
+
+// otTable is a view of an OpenType table that returns zero values instead of
+// panicking when the font data is truncated or malformed.
+type otTable []byte
+
+func (t otTable) u16(off int) int {
+	if off < 0 || off+2 > len(t) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(t[off:]))
+}
+
+func (t otTable) i16(off int) int {
+	return int(int16(t.u16(off)))
+}
+
+func (t otTable) u32(off int) uint32 {
+	if off < 0 || off+4 > len(t) {
+		return 0
+	}
+	return binary.BigEndian.Uint32(t[off:])
+}
+
+func (t otTable) sub(off int) otTable {
+	if off <= 0 || off >= len(t) {
+		return nil
+	}
+	return t[off:]
+}
+
+// findTable returns the contents of the table with the given tag in an
+// OpenType font file, or nil if there is none.
+func findTable(src []byte, tag uint32) otTable {
+	font := otTable(src)
+	n := font.u16(4)
+	for i := 0; i < n; i++ {
+		rec := 12 + 16*i
+		if font.u32(rec) != tag {
+			continue
+		}
+		off, length := int(font.u32(rec+8)), int(font.u32(rec+12))
+		if off+length > len(src) {
+			return nil
+		}
+		return otTable(src[off : off+length])
+	}
+	return nil
+}
+
+// coverageIndex returns the coverage index of a glyph, or -1 if the glyph is
+// not covered.
+func (t otTable) coverageIndex(g sfnt.GlyphIndex) int {
+	switch t.u16(0) {
+	case 1:
+		n := t.u16(2)
+		lo, hi := 0, n
+		for lo < hi {
+			i := (lo + hi) / 2
+			switch x := sfnt.GlyphIndex(t.u16(4 + 2*i)); {
+			case x < g:
+				lo = i + 1
+			case x > g:
+				hi = i
+			default:
+				return i
+			}
+		}
+	case 2:
+		n := t.u16(2)
+		lo, hi := 0, n
+		for lo < hi {
+			i := (lo + hi) / 2
+			rec := 4 + 6*i
+			switch {
+			case sfnt.GlyphIndex(t.u16(rec+2)) < g:
+				lo = i + 1
+			case sfnt.GlyphIndex(t.u16(rec)) > g:
+				hi = i
+			default:
+				return t.u16(rec+4) + int(g) - t.u16(rec)
+			}
+		}
+	}
+	return -1
+}
+
+// glyphClass returns the class of a glyph in a class definition table.
+// Glyphs not listed are in class 0.
+func (t otTable) glyphClass(g sfnt.GlyphIndex) int {
+	switch t.u16(0) {
+	case 1:
+		start, n := t.u16(2), t.u16(4)
+		if i := int(g) - start; i >= 0 && i < n {
+			return t.u16(6 + 2*i)
+		}
+	case 2:
+		n := t.u16(2)
+		lo, hi := 0, n
+		for lo < hi {
+			i := (lo + hi) / 2
+			rec := 4 + 6*i
+			switch {
+			case sfnt.GlyphIndex(t.u16(rec+2)) < g:
+				lo = i + 1
+			case sfnt.GlyphIndex(t.u16(rec)) > g:
+				hi = i
+			default:
+				return t.u16(rec + 4)
+			}
+		}
+	}
+	return 0
+}
+
+// otLayoutTable is the common structure of GSUB and GPOS.
+type otLayoutTable struct {
+	table otTable
+}
+
+// featureLookups returns the indices of the lookups implementing a feature
+// for a script, using the default language system of the script.
+func (l otLayoutTable) featureLookups(script, feature uint32) []int {
+	t := l.table
+	if t == nil {
+		return nil
+	}
+	scripts := t.sub(t.u16(4))
+	features := t.sub(t.u16(6))
+	var langSys otTable
+	for _, tag := range []uint32{script, tagDFLT, tagLatn} {
+		for i, n := 0, scripts.u16(0); i < n; i++ {
+			if scripts.u32(2+6*i) == tag {
+				s := scripts.sub(scripts.u16(2 + 6*i + 4))
+				langSys = s.sub(s.u16(0))
+				break
+			}
+		}
+		if langSys != nil {
+			break
+		}
+	}
+	if langSys == nil {
+		return nil
+	}
+	var lookups []int
+	for i, n := 0, langSys.u16(4); i < n; i++ {
+		fi := langSys.u16(6 + 2*i)
+		if features.u32(2+6*fi) != feature {
+			continue
+		}
+		f := features.sub(features.u16(2 + 6*fi + 4))
+		for j, m := 0, f.u16(2); j < m; j++ {
+			lookups = append(lookups, f.u16(4+2*j))
+		}
+	}
+	return lookups
+}
+
+// lookupSubtables returns the type and subtables of a lookup, resolving
+// extension subtables.
+func (l otLayoutTable) lookupSubtables(index int, extensionType int) (int, []otTable) {
+	lookupList := l.table.sub(l.table.u16(8))
+	if index >= lookupList.u16(0) {
+		return 0, nil
+	}
+	lookup := lookupList.sub(lookupList.u16(2 + 2*index))
+	kind := lookup.u16(0)
+	n := lookup.u16(4)
+	subtables := make([]otTable, 0, n)
+	for i := 0; i < n; i++ {
+		st := lookup.sub(lookup.u16(6 + 2*i))
+		if lookup.u16(0) == extensionType {
+			kind = st.u16(2)
+			st = st.sub(int(st.u32(4)))
+		}
+		subtables = append(subtables, st)
+	}
+	return kind, subtables
+}
+
+// shapingGlyph is a glyph in the shaper's buffer.
+type shapingGlyph struct {
+	index   sfnt.GlyphIndex
+	cluster int // index of the first rune the glyph comes from
+	form    uint32
+	mark    bool
+}
+
+type gsubTable struct {
+	otLayoutTable
+}
+
+// apply runs the lookups of a feature over the glyphs.  When form is not 0,
+// only glyphs whose form matches are substituted (this is used for the
+// Arabic positional forms).
+func (t gsubTable) apply(glyphs []shapingGlyph, script, feature uint32, form uint32) []shapingGlyph {
+	for _, lookup := range t.featureLookups(script, feature) {
+		kind, subtables := t.lookupSubtables(lookup, 7)
+		for i := 0; i < len(glyphs); i++ {
+			if form != 0 && glyphs[i].form != form {
+				continue
+			}
+			for _, st := range subtables {
+				var ok bool
+				switch kind {
+				case 1:
+					ok = t.applySingle(st, &glyphs[i])
+				case 4:
+					glyphs, ok = t.applyLigature(st, glyphs, i)
+				}
+				if ok {
+					break
+				}
+			}
+		}
+	}
+	return glyphs
+}
+
+func (t gsubTable) applySingle(st otTable, g *shapingGlyph) bool {
+	ci := st.sub(st.u16(2)).coverageIndex(g.index)
+	if ci < 0 {
+		return false
+	}
+	switch st.u16(0) {
+	case 1:
+		g.index = sfnt.GlyphIndex(int(g.index) + st.i16(4))
+	case 2:
+		if ci >= st.u16(4) {
+			return false
+		}
+		g.index = sfnt.GlyphIndex(st.u16(6 + 2*ci))
+	default:
+		return false
+	}
+	return true
+}
+
+func (t gsubTable) applyLigature(st otTable, glyphs []shapingGlyph, i int) ([]shapingGlyph, bool) {
+	ci := st.sub(st.u16(2)).coverageIndex(glyphs[i].index)
+	if ci < 0 || ci >= st.u16(4) {
+		return glyphs, false
+	}
+	set := st.sub(st.u16(6 + 2*ci))
+	for j, n := 0, set.u16(0); j < n; j++ {
+		lig := set.sub(set.u16(2 + 2*j))
+		count := lig.u16(2)
+		if count == 0 || i+count > len(glyphs) {
+			continue
+		}
+		match := true
+		for k := 1; k < count; k++ {
+			if glyphs[i+k].index != sfnt.GlyphIndex(lig.u16(4+2*(k-1))) {
+				match = false
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		glyphs[i].index = sfnt.GlyphIndex(lig.u16(0))
+		return append(glyphs[:i+1], glyphs[i+count:]...), true
+	}
+	return glyphs, false
+}
+
+type gposTable struct {
+	otLayoutTable
+}
+
+// markOffset returns the offset to apply to a mark glyph so that it attaches
+// to the base glyph, in font units, if the font specifies one.
+func (t gposTable) markOffset(script uint32, base, mark sfnt.GlyphIndex) (dx, dy int, ok bool) {
+	for _, lookup := range t.featureLookups(script, tagMark) {
+		kind, subtables := t.lookupSubtables(lookup, 9)
+		if kind != 4 {
+			continue
+		}
+		for _, st := range subtables {
+			mi := st.sub(st.u16(2)).coverageIndex(mark)
+			bi := st.sub(st.u16(4)).coverageIndex(base)
+			if mi < 0 || bi < 0 {
+				continue
+			}
+			classCount := st.u16(6)
+			markArray := st.sub(st.u16(8))
+			baseArray := st.sub(st.u16(10))
+			class := markArray.u16(2 + 4*mi)
+			markAnchor := markArray.sub(markArray.u16(2 + 4*mi + 2))
+			baseAnchor := baseArray.sub(baseArray.u16(2 + 2*(bi*classCount+class)))
+			if markAnchor == nil || baseAnchor == nil {
+				continue
+			}
+			return baseAnchor.i16(2) - markAnchor.i16(2), baseAnchor.i16(4) - markAnchor.i16(4), true
+		}
+	}
+	return 0, 0, false
+}
+
+// Flags of a GPOS value format, telling which fields a value record has.
+const (
+	valueXPlacement = 1 << iota
+	valueYPlacement
+	valueXAdvance
+)
+
+// valueRecordSize returns the size of a value record of a format.
+func valueRecordSize(format int) int {
+	size := 0
+	for ; format != 0; format >>= 1 {
+		size += 2 * (format & 1)
+	}
+	return size
+}
+
+// xAdvance returns the horizontal advance adjustment of a value record.
+func xAdvance(rec otTable, format int) int {
+	if format&valueXAdvance == 0 {
+		return 0
+	}
+	return rec.i16(valueRecordSize(format & (valueXAdvance - 1)))
+}
+
+// pairKerning returns the adjustment of the advance of the left glyph of a
+// pair, in font units, if the font kerns the pair.
+func (t gposTable) pairKerning(script uint32, left, right sfnt.GlyphIndex) (int, bool) {
+	for _, lookup := range t.featureLookups(script, tagKern) {
+		kind, subtables := t.lookupSubtables(lookup, 9)
+		if kind != 2 {
+			continue
+		}
+		for _, st := range subtables {
+			ci := st.sub(st.u16(2)).coverageIndex(left)
+			if ci < 0 {
+				continue
+			}
+			format1, format2 := st.u16(4), st.u16(6)
+			size1, size2 := valueRecordSize(format1), valueRecordSize(format2)
+			switch st.u16(0) {
+			case 1:
+				if ci >= st.u16(8) {
+					continue
+				}
+				set := st.sub(st.u16(10 + 2*ci))
+				stride := 2 + size1 + size2
+				lo, hi := 0, set.u16(0)
+				for lo < hi {
+					i := (lo + hi) / 2
+					rec := 2 + stride*i
+					switch second := sfnt.GlyphIndex(set.u16(rec)); {
+					case second < right:
+						lo = i + 1
+					case second > right:
+						hi = i
+					default:
+						return xAdvance(set.sub(rec+2), format1), true
+					}
+				}
+			case 2:
+				class1 := st.sub(st.u16(8)).glyphClass(left)
+				class2 := st.sub(st.u16(10)).glyphClass(right)
+				count1, count2 := st.u16(12), st.u16(14)
+				if class1 >= count1 || class2 >= count2 {
+					continue
+				}
+				rec := 16 + (size1+size2)*(class1*count2+class2)
+				return xAdvance(st.sub(rec), format1), true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"golang.org/x/image/font/sfnt"
+)
+
+// ref stands for the offset of a child in the fields of an OpenType table.
+type ref int
+
+// table lays out an OpenType table: fields, which are 16-bit ints, 32-bit
+// tags and refs, followed by the children that the refs point to.
+func table(fields []interface{}, children ...[]byte) []byte {
+	size := 0
+	for _, f := range fields {
+		if _, ok := f.(uint32); ok {
+			size += 4
+		} else {
+			size += 2
+		}
+	}
+	offsets := make([]int, len(children))
+	end := size
+	for i, c := range children {
+		offsets[i] = end
+		end += len(c)
+	}
+	var t []byte
+	for _, f := range fields {
+		switch f := f.(type) {
+		case int:
+			t = binary.BigEndian.AppendUint16(t, uint16(f))
+		case ref:
+			t = binary.BigEndian.AppendUint16(t, uint16(offsets[f]))
+		case uint32:
+			t = binary.BigEndian.AppendUint32(t, f)
+		}
+	}
+	for _, c := range children {
+		t = append(t, c...)
+	}
+	return t
+}
+
+// layoutTable lays out a GSUB or GPOS table with a single lookup of a
+// feature for a script.
+func layoutTable(script, feature uint32, kind int, subtables ...[]byte) otLayoutTable {
+	langSys := table([]interface{}{0, 0xFFFF, 1, 0})
+	scripts := table([]interface{}{1, script, ref(0)}, table([]interface{}{ref(0), 0}, langSys))
+	features := table([]interface{}{1, feature, ref(0)}, table([]interface{}{0, 1, 0}))
+	fields := []interface{}{kind, 0, len(subtables)}
+	for i := range subtables {
+		fields = append(fields, ref(i))
+	}
+	lookups := table([]interface{}{1, ref(0)}, table(fields, subtables...))
+	return otLayoutTable{table([]interface{}{1, 0, ref(0), ref(1), ref(2)}, scripts, features, lookups)}
+}
+
+// coverage lays out a coverage table of format 1.
+func coverage(glyphs ...int) []byte {
+	fields := []interface{}{1, len(glyphs)}
+	for _, g := range glyphs {
+		fields = append(fields, g)
+	}
+	return table(fields)
+}
+
+func shapingGlyphs(indices ...int) []shapingGlyph {
+	glyphs := make([]shapingGlyph, len(indices))
+	for i, index := range indices {
+		glyphs[i] = shapingGlyph{index: sfnt.GlyphIndex(index), cluster: i}
+	}
+	return glyphs
+}
+
+func glyphIndices(glyphs []shapingGlyph) []int {
+	indices := make([]int, len(glyphs))
+	for i, g := range glyphs {
+		indices[i] = int(g.index)
+	}
+	return indices
+}
+
+func TestCoverageIndex(t *testing.T) {
+	ranges := otTable(table([]interface{}{2, 2, 10, 12, 0, 20, 20, 3}))
+	tests := []struct {
+		coverage otTable
+		glyph    sfnt.GlyphIndex
+		want     int
+	}{
+		{otTable(coverage(3, 5, 9)), 3, 0},
+		{otTable(coverage(3, 5, 9)), 9, 2},
+		{otTable(coverage(3, 5, 9)), 4, -1},
+		{ranges, 10, 0},
+		{ranges, 12, 2},
+		{ranges, 20, 3},
+		{ranges, 13, -1},
+		{nil, 3, -1},
+	}
+	for _, test := range tests {
+		if got := test.coverage.coverageIndex(test.glyph); got != test.want {
+			t.Errorf("coverageIndex(%d) = %d, want %d", test.glyph, got, test.want)
+		}
+	}
+}
+
+func TestGlyphClass(t *testing.T) {
+	array := otTable(table([]interface{}{1, 5, 3, 1, 0, 2}))
+	ranges := otTable(table([]interface{}{2, 2, 10, 12, 1, 20, 29, 2}))
+	tests := []struct {
+		classes otTable
+		glyph   sfnt.GlyphIndex
+		want    int
+	}{
+		{array, 5, 1},
+		{array, 6, 0},
+		{array, 7, 2},
+		{array, 8, 0},
+		{ranges, 11, 1},
+		{ranges, 25, 2},
+		{ranges, 15, 0},
+	}
+	for _, test := range tests {
+		if got := test.classes.glyphClass(test.glyph); got != test.want {
+			t.Errorf("glyphClass(%d) = %d, want %d", test.glyph, got, test.want)
+		}
+	}
+}
+
+func TestSingleSubstitution(t *testing.T) {
+	delta := table([]interface{}{1, ref(0), 100}, coverage(1, 2))
+	list := table([]interface{}{2, ref(0), 2, 50, 60}, coverage(3, 4))
+	gsub := gsubTable{layoutTable(tagLatn, tagLiga, 1, delta, list)}
+	got := glyphIndices(gsub.apply(shapingGlyphs(1, 2, 3, 4, 5), tagLatn, tagLiga, 0))
+	if want := []int{101, 102, 50, 60, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSingleSubstitutionForms(t *testing.T) {
+	st := table([]interface{}{1, ref(0), 100}, coverage(1))
+	gsub := gsubTable{layoutTable(tagArab, tagFina, 1, st)}
+	glyphs := shapingGlyphs(1, 1)
+	glyphs[1].form = tagFina
+	got := glyphIndices(gsub.apply(glyphs, tagArab, tagFina, tagFina))
+	if want := []int{1, 101}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestLigatureSubstitution(t *testing.T) {
+	// f is 1, i is 2 and l is 3.  ffi is 10, fi is 11 and fl is 12.
+	set := table([]interface{}{3, ref(0), ref(1), ref(2)},
+		table([]interface{}{10, 3, 1, 2}),
+		table([]interface{}{11, 2, 2}),
+		table([]interface{}{12, 2, 3}))
+	st := table([]interface{}{1, ref(0), 1, ref(1)}, coverage(1), set)
+	gsub := gsubTable{layoutTable(tagLatn, tagLiga, 4, st)}
+	tests := []struct {
+		glyphs []int
+		want   []int
+	}{
+		{[]int{1, 2}, []int{11}},
+		{[]int{1, 1, 2}, []int{10}},
+		{[]int{2, 1, 3, 1}, []int{2, 12, 1}},
+		{[]int{1}, []int{1}},
+	}
+	for _, test := range tests {
+		glyphs := gsub.apply(shapingGlyphs(test.glyphs...), tagLatn, tagLiga, 0)
+		if got := glyphIndices(glyphs); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: got %v, want %v", test.glyphs, got, test.want)
+		}
+	}
+	glyphs := gsub.apply(shapingGlyphs(2, 1, 2), tagLatn, tagLiga, 0)
+	if glyphs[1].cluster != 1 {
+		t.Errorf("ligature cluster = %d, want 1", glyphs[1].cluster)
+	}
+}
+
+func TestFeatureLookupsFallBackToDefaultScript(t *testing.T) {
+	l := layoutTable(tagDFLT, tagLiga, 1)
+	if got := l.featureLookups(tagHebr, tagLiga); !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("featureLookups(hebr, liga) = %v, want [0]", got)
+	}
+	if got := l.featureLookups(tagHebr, tagKern); got != nil {
+		t.Errorf("featureLookups(hebr, kern) = %v, want none", got)
+	}
+}
+
+func TestPairKerning(t *testing.T) {
+	// A is 1, B is 2, V is 5 and W is 6.
+	pairs := table([]interface{}{1, ref(0), valueXAdvance, 0, 1, ref(1)},
+		coverage(1),
+		table([]interface{}{2, 5, -80, 6, -40}))
+	placed := table([]interface{}{1, ref(0), valueXPlacement | valueXAdvance, 0, 1, ref(1)},
+		coverage(2),
+		table([]interface{}{1, 5, 7, -30}))
+	classes := table([]interface{}{2, ref(0), valueXAdvance, 0, ref(1), ref(2), 2, 2, 0, 0, 0, -60},
+		coverage(1, 3),
+		table([]interface{}{1, 1, 1, 1}),
+		table([]interface{}{2, 1, 5, 6, 1}))
+	tests := []struct {
+		gpos        gposTable
+		left, right sfnt.GlyphIndex
+		want        int
+		wantOK      bool
+	}{
+		{gposTable{layoutTable(tagLatn, tagKern, 2, pairs)}, 1, 5, -80, true},
+		{gposTable{layoutTable(tagLatn, tagKern, 2, pairs)}, 1, 6, -40, true},
+		{gposTable{layoutTable(tagLatn, tagKern, 2, pairs)}, 1, 7, 0, false},
+		{gposTable{layoutTable(tagLatn, tagKern, 2, pairs)}, 2, 5, 0, false},
+		{gposTable{layoutTable(tagLatn, tagKern, 2, placed)}, 2, 5, -30, true},
+		{gposTable{layoutTable(tagLatn, tagKern, 2, classes)}, 1, 6, -60, true},
+		{gposTable{layoutTable(tagLatn, tagKern, 2, classes)}, 1, 7, 0, true},
+		{gposTable{layoutTable(tagLatn, tagKern, 2, classes)}, 3, 5, 0, true},
+		{gposTable{layoutTable(tagLatn, tagKern, 2, classes)}, 2, 5, 0, false},
+		{gposTable{layoutTable(tagLatn, tagMark, 2, pairs)}, 1, 5, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := test.gpos.pairKerning(tagLatn, test.left, test.right)
+		if got != test.want || ok != test.wantOK {
+			t.Errorf("pairKerning(%d, %d) = %d, %t, want %d, %t", test.left, test.right, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestMarkOffset(t *testing.T) {
+	// The base is 1 and the mark is 2.
+	anchor := func(x, y int) []byte { return table([]interface{}{1, x, y}) }
+	st := table([]interface{}{1, ref(0), ref(1), 1, ref(2), ref(3)},
+		coverage(2),
+		coverage(1),
+		table([]interface{}{1, 0, ref(0)}, anchor(100, -20)),
+		table([]interface{}{1, ref(0)}, anchor(250, 500)))
+	gpos := gposTable{layoutTable(tagHebr, tagMark, 4, st)}
+	dx, dy, ok := gpos.markOffset(tagHebr, 1, 2)
+	if dx != 150 || dy != 520 || !ok {
+		t.Errorf("markOffset(1, 2) = %d, %d, %t, want 150, 520, true", dx, dy, ok)
+	}
+	if _, _, ok := gpos.markOffset(tagHebr, 2, 1); ok {
+		t.Errorf("markOffset(2, 1) found an offset")
+	}
+}
+
+func TestFindTable(t *testing.T) {
+	gsub := []byte("gsub data")
+	src := table([]interface{}{1, 0, 2, 0, 0, 0,
+		tagGPOS, 0, 0, 0, 0, 0, 0,
+		tagGSUB, 0, 0, 0, 44, 0, len(gsub)})
+	src = append(src, gsub...)
+	if got := string(findTable(src, tagGSUB)); got != string(gsub) {
+		t.Errorf("findTable(GSUB) = %q, want %q", got, gsub)
+	}
+	if got := findTable(src, tagKern); got != nil {
+		t.Errorf("findTable(kern) = %q, want nil", got)
+	}
+}
+
+func TestValueRecord(t *testing.T) {
+	format := valueXPlacement | valueYPlacement | valueXAdvance
+	if got := valueRecordSize(format); got != 6 {
+		t.Errorf("valueRecordSize = %d, want 6", got)
+	}
+	if got := xAdvance(otTable(table([]interface{}{1, 2, -3})), format); got != -3 {
+		t.Errorf("xAdvance = %d, want -3", got)
+	}
+	if got := xAdvance(otTable(table([]interface{}{1, 2})), valueXPlacement|valueYPlacement); got != 0 {
+		t.Errorf("xAdvance without an advance = %d, want 0", got)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// A PageLayout describes fixed-size pages.  Sizes are unscaled.  The running
+// header, with the title of the current section, and the footer, with the
+// page number, are drawn in the top and bottom margins.
+type PageLayout struct {
+	Width, Height float64
+	Margins       Margins
+	HeaderStyle   TextStyle
+	HeaderColor   color.Color
+	Background    color.Color
+}
+
+// Paginate lays out a block on pages.  The content is split between blocks
+// or lines, following the breaking rules of the boxes.  Content too high for
+// a page is clipped to its margins.
+func Paginate(ctx RenderingContext, block Block, layout PageLayout) []Box {
+	width := int(math.Round(layout.Width * ctx.Scale))
+	height := int(math.Round(layout.Height * ctx.Scale))
+	margins := ctx.ScaleMargins(layout.Margins)
+	left, top := int(margins.Left), int(margins.Top)
+	contentWidth := width - left - int(margins.Right)
+	contentHeight := height - top - int(margins.Bottom)
+	if contentWidth <= 0 || contentHeight <= 0 {
+		return nil
+	}
+
+	var contents []Box
+	for rest := block.Layout(ctx, Constraints{Width: contentWidth}); rest != nil; {
+		var page Box
+		page, rest = splitBox(rest, contentHeight)
+		if page == nil {
+			page, rest = forceSplit(rest)
+		}
+		if page.Bounds().Dy() > contentHeight {
+			page = &ClipBox{inner: page, height: contentHeight}
+		}
+		contents = append(contents, page)
+	}
+
+	pages := make([]Box, len(contents))
+	section := ""
+	for i, content := range contents {
+		sections := boxHeadings(content, image.Point{})
+		if len(sections) > 0 {
+			section = sections[0].title
+		}
+		children := []ChildBox{
+			{Box: &FillBox{image.Rect(0, 0, width, height), layout.Background}},
+			{Box: content, Pos: image.Pt(left, top)},
+		}
+		if section != "" {
+			header := layout.runningLine(ctx, section)
+			y := (top - header.Bounds().Dy()) / 2
+			children = append(children, ChildBox{Box: header, Pos: image.Pt(left, y)})
+		}
+		footer := layout.runningLine(ctx, fmt.Sprintf("%d / %d", i+1, len(contents)))
+		x := (width - footer.Bounds().Dx()) / 2
+		y := height - (int(margins.Bottom)+footer.Bounds().Dy())/2
+		children = append(children, ChildBox{Box: footer, Pos: image.Pt(x, y)})
+		pages[i] = NewGroupBox(children)
+		if len(sections) > 0 {
+			section = sections[len(sections)-1].title
+		}
+	}
+	return pages
+}
+
+func (l PageLayout) runningLine(ctx RenderingContext, text string) Box {
+	return textLine(ctx, l.HeaderStyle, l.HeaderColor, text)
+}
+
+// forceSplit breaks a box that can't be split within a page: a stack loses
+// its first box, anything else goes on a page of its own and is clipped.
+func forceSplit(box Box) (Box, Box) {
+	if stack, ok := box.(*StackBox); ok && len(stack.boxes) > 1 {
+		return &StackBox{boxes: stack.boxes[:1]}, &StackBox{boxes: stack.boxes[1:]}
+	}
+	return box, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+// line returns a box as high as a line of text.
+func line(height int) Box {
+	return &FillBox{bounds: image.Rect(0, 0, 10, height)}
+}
+
+func lines(n, height int) []Box {
+	boxes := make([]Box, n)
+	for i := range boxes {
+		boxes[i] = line(height)
+	}
+	return boxes
+}
+
+// stackHeights returns the heights of the boxes of a stack, or nil for no
+// stack.
+func stackHeights(box Box) []int {
+	if box == nil {
+		return nil
+	}
+	stack, ok := box.(*StackBox)
+	if !ok {
+		return []int{box.Bounds().Dy()}
+	}
+	heights := []int{}
+	for _, b := range stack.boxes {
+		heights = append(heights, b.Bounds().Dy())
+	}
+	return heights
+}
+
+func TestStackBoxSplitAt(t *testing.T) {
+	keep := &KeepBox{Box: line(10), withNext: true}
+	tests := []struct {
+		name             string
+		stack            *StackBox
+		height           int
+		head, tail       []int
+		headNil, tailNil bool
+	}{
+		{
+			name:   "between lines",
+			stack:  &StackBox{boxes: lines(5, 10)},
+			height: 25,
+			head:   []int{10, 10},
+			tail:   []int{10, 10, 10},
+		},
+		{
+			name:    "fits",
+			stack:   &StackBox{boxes: lines(5, 10)},
+			height:  50,
+			head:    []int{10, 10, 10, 10, 10},
+			tailNil: true,
+		},
+		{
+			name:    "orphans",
+			stack:   &StackBox{boxes: lines(5, 10), orphans: 2, widows: 2},
+			height:  15,
+			headNil: true,
+			tail:    []int{10, 10, 10, 10, 10},
+		},
+		{
+			name:   "widows",
+			stack:  &StackBox{boxes: lines(5, 10), orphans: 2, widows: 2},
+			height: 45,
+			head:   []int{10, 10, 10},
+			tail:   []int{10, 10},
+		},
+		{
+			name:    "more widows than lines",
+			stack:   &StackBox{boxes: lines(2, 10), widows: 3},
+			height:  15,
+			headNil: true,
+			tail:    []int{10, 10},
+		},
+		{
+			name:   "keep with next",
+			stack:  &StackBox{boxes: []Box{line(10), keep, line(10), line(10)}},
+			height: 25,
+			head:   []int{10},
+			tail:   []int{10, 10, 10},
+		},
+		{
+			name:   "empty box at the break",
+			stack:  &StackBox{boxes: []Box{line(10), line(10), NewEmptyBox(10, 10), line(10)}},
+			height: 25,
+			head:   []int{10, 10},
+			tail:   []int{10},
+		},
+		{
+			name:   "nested",
+			stack:  &StackBox{boxes: []Box{line(10), &StackBox{boxes: lines(3, 10)}}},
+			height: 25,
+			head:   []int{10, 10},
+			tail:   []int{20},
+		},
+		{
+			name:    "too high",
+			stack:   &StackBox{boxes: []Box{line(100), line(10)}},
+			height:  50,
+			headNil: true,
+			tail:    []int{100, 10},
+		},
+	}
+	for _, test := range tests {
+		head, tail := test.stack.SplitAt(test.height)
+		if (head == nil) != test.headNil || (tail == nil) != test.tailNil {
+			t.Errorf("%s: got head %v and tail %v", test.name, head, tail)
+			continue
+		}
+		if test.headNil {
+			test.head = nil
+		}
+		if test.tailNil {
+			test.tail = nil
+		}
+		if got := stackHeights(head); !reflect.DeepEqual(got, test.head) {
+			t.Errorf("%s: head heights = %v, want %v", test.name, got, test.head)
+		}
+		if got := stackHeights(tail); !reflect.DeepEqual(got, test.tail) {
+			t.Errorf("%s: tail heights = %v, want %v", test.name, got, test.tail)
+		}
+	}
+}
+
+// boxBlock is a block laid out as a given box.
+type boxBlock struct {
+	Block
+	box Box
+}
+
+func (b boxBlock) Layout(ctx RenderingContext, c Constraints) Box {
+	return b.box
+}
+
+func TestPaginate(t *testing.T) {
+	ctx := RenderingContext{Scale: 1, FaceSelector: NewGoFontFaceSelector(72)}
+	layout := PageLayout{
+		Width:       100,
+		Height:      100,
+		Margins:     Margins{Top: 10, Bottom: 10, Left: 10, Right: 10},
+		HeaderStyle: TextStyle{Size: 6},
+	}
+	tests := []struct {
+		name string
+		box  Box
+		want []int // the height of the content of each page
+	}{
+		{"lines", &StackBox{boxes: lines(20, 10)}, []int{80, 80, 40}},
+		{"widows", &StackBox{boxes: lines(9, 10), orphans: 2, widows: 2}, []int{70, 20}},
+		{"too high", line(200), []int{80}},
+		{"too high first", &StackBox{boxes: []Box{line(200), line(10)}}, []int{80, 10}},
+		{"empty", &StackBox{}, []int{0}},
+	}
+	for _, test := range tests {
+		pages := Paginate(ctx, boxBlock{box: test.box}, layout)
+		var got []int
+		for _, page := range pages {
+			if page.Bounds() != image.Rect(0, 0, 100, 100) {
+				t.Errorf("%s: page bounds = %v", test.name, page.Bounds())
+			}
+			content := page.(*GroupBox).Children()[1]
+			if content.Pos != image.Pt(10, 10) {
+				t.Errorf("%s: content at %v, want (10,10)", test.name, content.Pos)
+			}
+			got = append(got, content.Bounds().Dy())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: page heights = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPaginateNoRoom(t *testing.T) {
+	ctx := RenderingContext{Scale: 1, FaceSelector: NewGoFontFaceSelector(72)}
+	layout := PageLayout{Width: 100, Height: 20, Margins: Margins{Top: 10, Bottom: 10}}
+	if pages := Paginate(ctx, boxBlock{box: line(10)}, layout); pages != nil {
+		t.Errorf("got %d pages, want none", len(pages))
+	}
+}
+
+func TestForceSplit(t *testing.T) {
+	head, tail := forceSplit(&StackBox{boxes: []Box{line(100), line(10), line(10)}})
+	if got := stackHeights(head); !reflect.DeepEqual(got, []int{100}) {
+		t.Errorf("head heights = %v, want [100]", got)
+	}
+	if got := stackHeights(tail); !reflect.DeepEqual(got, []int{10, 10}) {
+		t.Errorf("tail heights = %v, want [10 10]", got)
+	}
+	box := line(100)
+	if head, tail := forceSplit(box); head != box || tail != nil {
+		t.Errorf("forceSplit of a line = %v, %v, want the line alone", head, tail)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+// A ScrollbarStyle is the style of the scrollbar and minimap of the document.
+// Sizes are unscaled.
+type ScrollbarStyle struct {
+	Width        float64
+	MinThumb     float64
+	Track        color.Color
+	Thumb        color.Color
+	MinimapWidth float64
+	MinimapView  color.Color // drawn over the part of the minimap in view
+}
+
+// clampOffset returns the scroll offset nearest to offset that keeps content
+// of the given height within a view: it can't scroll past either end, and
+// content shorter than the view stays at the top.
+func clampOffset(offset float64, content, view int) float64 {
+	return math.Max(math.Min(offset, 0), math.Min(float64(view-content), 0))
+}
+
+// A scrollbar is the vertical scrollbar of a view onto content of a given
+// height.
+type scrollbar struct {
+	track   image.Rectangle
+	thumb   image.Rectangle
+	content int
+}
+
+func newScrollbar(track image.Rectangle, content, minThumb int, offset float64) scrollbar {
+	s := scrollbar{track: track, thumb: track, content: content}
+	view := track.Dy()
+	if content <= view {
+		return s
+	}
+	s.thumb.Max.Y = track.Min.Y + minInt(maxInt(view*view/content, minThumb), view)
+	s.thumb = s.thumb.Add(image.Pt(0, s.offsetToThumb(offset)))
+	return s
+}
+
+func (s scrollbar) offsetToThumb(offset float64) int {
+	return int(-offset * float64(s.track.Dy()-s.thumb.Dy()) / float64(s.content-s.track.Dy()))
+}
+
+// offsetAt returns the scroll offset that puts the top of the thumb at y.
+func (s scrollbar) offsetAt(y int) float64 {
+	space := s.track.Dy() - s.thumb.Dy()
+	if space <= 0 {
+		return 0
+	}
+	return -float64(y-s.track.Min.Y) * float64(s.content-s.track.Dy()) / float64(space)
+}
+
+func (s scrollbar) Draw(dst *ebiten.Image, style ScrollbarStyle) {
+	(&FillBox{s.track, style.Track}).Draw(dst, 0, 0)
+	if s.content > s.track.Dy() {
+		(&FillBox{s.thumb, style.Thumb}).Draw(dst, 0, 0)
+	}
+}
+
+// A minimap is a downscaled rendering of the laid-out document.  It is drawn
+// again only when the size of the document changes.
+type minimap struct {
+	image *ebiten.Image
+	size  image.Point // of the document
+	scale float64
+}
+
+// The largest minimap rendered, and the height of the slices of the document
+// it's rendered from.
+const (
+	minimapMaxHeight = 8192
+	minimapSlice     = 1024
+)
+
+func (m *minimap) update(box Box, width int) {
+	size := box.Bounds().Max
+	if m.image != nil && size == m.size {
+		return
+	}
+	if m.image != nil {
+		m.image.Dispose()
+		m.image = nil
+	}
+	m.size = size
+	if size.X <= 0 || size.Y <= 0 {
+		return
+	}
+	m.scale = math.Min(float64(width)/float64(size.X), float64(minimapMaxHeight)/float64(size.Y))
+	m.image = ebiten.NewImage(width, int(math.Ceil(float64(size.Y)*m.scale)))
+	slice := ebiten.NewImage(size.X, minimapSlice)
+	defer slice.Dispose()
+	for y := 0; y < size.Y; y += minimapSlice {
+		slice.Clear()
+		box.Draw(slice, 0, -y)
+		op := &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear}
+		op.GeoM.Translate(0, float64(y))
+		op.GeoM.Scale(m.scale, m.scale)
+		m.image.DrawImage(slice, op)
+	}
+}
+
+// invalidate makes update draw the minimap again, of a new document.
+func (m *minimap) invalidate() {
+	m.size = image.Point{}
+}
+
+// mapOffset returns how far the minimap is scrolled in a view of height
+// view: it moves along with the document when it's taller than the view.
+func (m *minimap) mapOffset(offset float64, view int) int {
+	height := m.image.Bounds().Dy()
+	if height <= view || m.size.Y <= view {
+		return 0
+	}
+	return int(-offset * float64(height-view) / float64(m.size.Y-view))
+}
+
+func (m *minimap) Draw(dst *ebiten.Image, rect image.Rectangle, offset float64, view int, style ScrollbarStyle) {
+	if m.image == nil {
+		return
+	}
+	mapY := m.mapOffset(offset, rect.Dy())
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(float64(rect.Min.X), float64(rect.Min.Y-mapY))
+	dst.DrawImage(m.image, op)
+	top := rect.Min.Y - mapY + int(-offset*m.scale)
+	viewRect := image.Rect(rect.Min.X, top, rect.Max.X, top+int(float64(view)*m.scale))
+	(&FillBox{viewRect, style.MinimapView}).Draw(dst, 0, 0)
+}
+
+// offsetAt returns the scroll offset that centers the view on the point of
+// the minimap at y.
+func (m *minimap) offsetAt(rect image.Rectangle, y int, offset float64, view int) float64 {
+	if m.image == nil {
+		return offset
+	}
+	docY := float64(y-rect.Min.Y+m.mapOffset(offset, rect.Dy())) / m.scale
+	return float64(view)/2 - docY
+}
+
+// A scroller animates a scroll offset.  The offset eases towards a target,
+// and the wheel gives the target a velocity that decays, so that scrolling
+// keeps going for a moment after the wheel stops.
+type scroller struct {
+	offset   float64
+	target   float64
+	velocity float64
+}
+
+const (
+	scrollEasing   = 0.25 // fraction of the distance to the target covered per tick
+	scrollFriction = 0.85 // fraction of the velocity kept per tick
+)
+
+// scrollBy moves the target.
+func (s *scroller) scrollBy(d float64) {
+	s.target += d
+	s.velocity = 0
+}
+
+// scrollTo sets the target.
+func (s *scroller) scrollTo(target float64) {
+	s.target = target
+	s.velocity = 0
+}
+
+// jumpTo sets the offset, without animation.
+func (s *scroller) jumpTo(offset float64) {
+	s.offset, s.target, s.velocity = offset, offset, 0
+}
+
+// fling adds to the velocity of the target.
+func (s *scroller) fling(v float64) {
+	s.velocity += v
+}
+
+// step advances the animation by a tick.
+func (s *scroller) step() {
+	s.target += s.velocity
+	s.velocity *= scrollFriction
+	if math.Abs(s.velocity) < 0.5 {
+		s.velocity = 0
+	}
+	s.offset += (s.target - s.offset) * scrollEasing
+	if math.Abs(s.target-s.offset) < 0.5 {
+		s.offset = s.target
+	}
+}
+
+// clamp keeps the offset and the target within content of the given height
+// shown in a view.  The velocity stops at either end.
+func (s *scroller) clamp(content, view int) {
+	s.offset = clampOffset(s.offset, content, view)
+	if target := clampOffset(s.target, content, view); target != s.target {
+		s.target, s.velocity = target, 0
+	}
+}
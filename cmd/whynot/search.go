@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// A SearchStyle is the style of the search bar and of the matches in the
+// document.
+type SearchStyle struct {
+	partStyle
+	Color        color.Color
+	LabelColor   color.Color // of the prompt and the counter
+	ErrorColor   color.Color
+	Match        color.Color
+	CurrentMatch color.Color
+}
+
+type textRange struct {
+	start, end textPos
+}
+
+// A search finds a query in the text of the document, as it would be copied,
+// so that matches may span several boxes.  The query is either matched
+// literally, ignoring case, or as a regular expression.
+type search struct {
+	query   string
+	regex   bool
+	err     error
+	matches []textRange
+	current int
+
+	// What the matches were found in.
+	foundQuery string
+	foundRegex bool
+	foundRuns  int
+}
+
+// find looks for the query again if it or the document changed, and reports
+// whether it did.
+func (s *search) find(runs []textRun) bool {
+	if s.query == s.foundQuery && s.regex == s.foundRegex && len(runs) == s.foundRuns {
+		return false
+	}
+	s.foundQuery, s.foundRegex, s.foundRuns = s.query, s.regex, len(runs)
+	s.matches, s.current, s.err = nil, 0, nil
+	if s.query == "" {
+		return true
+	}
+	pattern := regexp.QuoteMeta(s.query)
+	if s.regex {
+		pattern = s.query
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		s.err = err
+		return true
+	}
+	s.matches = findMatches(runs, re)
+	return true
+}
+
+// findMatches returns the non-empty matches of re in the text of the runs.
+func findMatches(runs []textRun, re *regexp.Regexp) []textRange {
+	var sb strings.Builder
+	starts := make([]int, len(runs))
+	for i, r := range runs {
+		if i > 0 {
+			sb.WriteString(runSeparator(runs[i-1], r))
+		}
+		starts[i] = sb.Len()
+		sb.WriteString(string(r.text))
+	}
+	text := sb.String()
+
+	// pos returns the position of a byte offset.  Offsets in separators
+	// are at the end of the run before them.
+	pos := func(offset int) textPos {
+		i := sort.Search(len(starts), func(i int) bool { return starts[i] > offset }) - 1
+		n := utf8.RuneCountInString(text[starts[i]:offset])
+		return textPos{i, minInt(n, len(runs[i].text))}
+	}
+	var matches []textRange
+	for _, m := range re.FindAllStringIndex(text, -1) {
+		if m[1] > m[0] {
+			matches = append(matches, textRange{pos(m[0]), pos(m[1])})
+		}
+	}
+	return matches
+}
+
+// invalidate makes find look for the query again, in a new document.
+func (s *search) invalidate() {
+	s.foundRuns = -1
+}
+
+// next moves to the next match, or the previous one if back is set.
+func (s *search) next(back bool) {
+	if n := len(s.matches); n > 0 {
+		if back {
+			s.current = (s.current + n - 1) % n
+		} else {
+			s.current = (s.current + 1) % n
+		}
+	}
+}
+
+// first moves to the first match at or after a position.
+func (s *search) first(pos textPos) {
+	s.current = 0
+	for i, m := range s.matches {
+		if !m.start.before(pos) {
+			s.current = i
+			return
+		}
+	}
+}
+
+// apply marks all the matches, and the current one differently.
+func (s *search) apply(runs []textRun, style SearchStyle) {
+	for i, m := range s.matches {
+		clr := style.Match
+		if i == s.current {
+			clr = style.CurrentMatch
+		}
+		markRange(runs, m.start, m.end, clr)
+	}
+}
+
+// bar lays out the search bar: the query and how many matches there are.
+func (s *search) bar(ctx RenderingContext, style SearchStyle, width int) Box {
+	return decorate(ctx, style.Decoration, width, func(width int) Box {
+		prompt := "Find:"
+		if s.regex {
+			prompt = "Find (regex):"
+		}
+		var status string
+		statusColor := style.LabelColor
+		switch {
+		case s.err != nil:
+			status, statusColor = "Invalid pattern", style.ErrorColor
+		case s.query == "":
+		case len(s.matches) == 0:
+			status = "No matches"
+		default:
+			status = fmt.Sprintf("%d / %d", s.current+1, len(s.matches))
+		}
+		label := textLine(ctx, style.TextStyle, style.LabelColor, prompt)
+		gap := gapWidth(ctx, style.TextStyle)
+		// The query is a single box so that its spaces show.
+		query := &InlineText{text: s.query + "|", style: style.TextStyle, color: style.Color}
+		queryBox := newLineBox(ctx, []InlineBox{query.GetInlineBox(ctx)}, 0, 0, AlignStart, 0)
+		children := []ChildBox{
+			{Box: label},
+			{Box: queryBox, Pos: image.Pt(label.Bounds().Dx()+gap, 0)},
+		}
+		if status != "" {
+			counter := textLine(ctx, style.TextStyle, statusColor, status)
+			children = append(children, ChildBox{Box: counter, Pos: image.Pt(width-counter.Bounds().Dx(), 0)})
+		}
+		return NewGroupBox(children)
+	})
+}
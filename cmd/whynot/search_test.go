@@ -0,0 +1,155 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// paragraphRuns returns the runs of paragraphs of words.
+func paragraphRuns(paragraphs ...[]string) []textRun {
+	var runs []textRun
+	for _, words := range paragraphs {
+		para := &StackBox{}
+		for _, w := range words {
+			runs = append(runs, textRun{text: []rune(w), para: para})
+		}
+	}
+	return runs
+}
+
+func TestFindMatches(t *testing.T) {
+	tests := []struct {
+		name  string
+		runs  []textRun
+		query string
+		want  []textRange
+	}{
+		{
+			name:  "in a run",
+			runs:  paragraphRuns([]string{"one", "bone", "ones"}),
+			query: "one",
+			want: []textRange{
+				{textPos{0, 0}, textPos{0, 3}},
+				{textPos{1, 1}, textPos{1, 4}},
+				{textPos{2, 0}, textPos{2, 3}},
+			},
+		},
+		{
+			name:  "across runs",
+			runs:  paragraphRuns([]string{"Hello", "world"}),
+			query: "o w",
+			want:  []textRange{{textPos{0, 4}, textPos{1, 1}}},
+		},
+		{
+			name:  "across paragraphs",
+			runs:  paragraphRuns([]string{"end"}, []string{"start"}),
+			query: `d\s+s`,
+			want:  []textRange{{textPos{0, 2}, textPos{1, 1}}},
+		},
+		{
+			name:  "runes",
+			runs:  paragraphRuns([]string{"café", "olé"}),
+			query: "é o",
+			want:  []textRange{{textPos{0, 3}, textPos{1, 1}}},
+		},
+		{
+			name:  "empty matches",
+			runs:  paragraphRuns([]string{"abc"}),
+			query: "x*",
+		},
+		{
+			name:  "no match",
+			runs:  paragraphRuns([]string{"abc"}),
+			query: "abd",
+		},
+		{
+			name:  "no runs",
+			query: "a",
+		},
+	}
+	for _, test := range tests {
+		got := findMatches(test.runs, regexp.MustCompile(test.query))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestFindMatchesInCode(t *testing.T) {
+	// Runs of code on the same line, or continuing a wrapped line, are
+	// joined without a space.
+	para := &StackBox{}
+	line1, line2, line3 := &LineBox{}, &LineBox{}, &LineBox{}
+	runs := []textRun{
+		{text: []rune("fmt."), para: para, line: line1, code: true},
+		{text: []rune("Println"), para: para, line: line1, code: true},
+		{text: []rune("x"), para: para, line: line2, code: true},
+		{text: []rune("y"), para: para, line: line3, code: true, wrapped: true},
+	}
+	want := []textRange{
+		{textPos{0, 0}, textPos{1, 7}},
+		{textPos{2, 0}, textPos{3, 1}},
+	}
+	got := findMatches(runs, regexp.MustCompile(`(?m)^fmt\.Println$|^xy$`))
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSearchFind(t *testing.T) {
+	runs := paragraphRuns([]string{"a", "b", "a"})
+	s := &search{query: "A"}
+	if !s.find(runs) || len(s.matches) != 2 {
+		t.Fatalf("found %v, want 2 matches ignoring case", s.matches)
+	}
+	if s.find(runs) {
+		t.Errorf("found again with the same query and document")
+	}
+	s.invalidate()
+	if !s.find(runs) {
+		t.Errorf("didn't find again after invalidate")
+	}
+	s.query, s.regex = "a|b", false
+	if s.find(runs); len(s.matches) != 0 {
+		t.Errorf("literal query found %v", s.matches)
+	}
+	s.regex = true
+	if s.find(runs); len(s.matches) != 3 {
+		t.Errorf("regular expression found %v, want 3 matches", s.matches)
+	}
+	s.query = "("
+	if s.find(runs); s.err == nil || s.matches != nil {
+		t.Errorf("invalid regular expression: err %v, matches %v", s.err, s.matches)
+	}
+}
+
+func TestSearchNextAndFirst(t *testing.T) {
+	s := &search{matches: []textRange{
+		{textPos{0, 0}, textPos{0, 1}},
+		{textPos{2, 0}, textPos{2, 1}},
+		{textPos{5, 3}, textPos{5, 4}},
+	}}
+	var got []int
+	for _, back := range []bool{false, false, false, true, true} {
+		s.next(back)
+		got = append(got, s.current)
+	}
+	if want := []int{1, 2, 0, 2, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("next: got %v, want %v", got, want)
+	}
+	tests := []struct {
+		pos  textPos
+		want int
+	}{
+		{textPos{0, 0}, 0},
+		{textPos{1, 5}, 1},
+		{textPos{5, 3}, 2},
+		{textPos{5, 4}, 0},
+	}
+	for _, test := range tests {
+		if s.first(test.pos); s.current != test.want {
+			t.Errorf("first(%v) = %d, want %d", test.pos, s.current, test.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"unicode"
+
+	"golang.org/x/image/math/fixed"
+)
+
+// Inline boxes with text that can be selected implement this.  Offsets are
+// in runes.
+type selectableBox interface {
+	InlineBox
+	selectableText() string
+	// copyText returns the text between two offsets, as it is copied.
+	copyText(start, end int) string
+	// hitTest returns the rune boundary nearest to x, from the left of the
+	// box.
+	hitTest(x fixed.Int26_6) int
+	mark(start, end int, clr color.Color)
+	clearMarks()
+	textMarks() []textMark
+}
+
+var (
+	_ selectableBox = (*TextBox)(nil)
+	_ selectableBox = (*SpansBox)(nil)
+)
+
+// A textRun is a selectable box of a laid-out document, in document order,
+// with what it takes to hit test it and to copy it as plain text.
+type textRun struct {
+	box  selectableBox
+	text []rune
+	rect image.Rectangle // in the document; as high as the line
+	line *LineBox
+	para *StackBox // the stack of lines the run is in
+
+	// Code is copied verbatim.  Lines of code that are wrapped continue
+	// the previous line.
+	code    bool
+	wrapped bool
+}
+
+// textRuns returns the selectable boxes of a box, at pos, in document order.
+func textRuns(box Box, pos image.Point) []textRun {
+	var runs []textRun
+	var walk func(box Box, pos image.Point, para *StackBox, code bool)
+	walk = func(box Box, pos image.Point, para *StackBox, code bool) {
+		switch b := box.(type) {
+		case *LineBox:
+			xs, _ := b.partPositions()
+			rect := b.Bounds().Add(pos)
+			wrapped := false
+			for i, part := range b.parts {
+				if t, ok := part.(*TextBox); ok && t.noSelect {
+					wrapped = i == 0
+					continue
+				}
+				s, ok := part.(selectableBox)
+				if !ok {
+					continue
+				}
+				_, advance := part.BoundsAndAdvance()
+				x := pos.X + xs[i].Round()
+				runs = append(runs, textRun{
+					box:     s,
+					text:    []rune(s.selectableText()),
+					rect:    image.Rect(x, rect.Min.Y, x+advance.Round(), rect.Max.Y),
+					line:    b,
+					para:    para,
+					code:    code,
+					wrapped: code && wrapped,
+				})
+			}
+			return
+		case *StackBox:
+			para = b
+		case *ScrollBox:
+			code = true
+		}
+		if parent, ok := box.(ParentBox); ok {
+			for _, child := range parent.Children() {
+				walk(child.Box, pos.Add(child.Pos), para, code)
+			}
+		}
+	}
+	walk(box, pos, nil, false)
+	return runs
+}
+
+// A textPos is a position in the selectable text of a document: a rune
+// boundary in one of its runs.
+type textPos struct {
+	run, offset int
+}
+
+func (p textPos) before(q textPos) bool {
+	return p.run < q.run || p.run == q.run && p.offset < q.offset
+}
+
+// hitTest returns the position in the text nearest to p.  The line is found
+// first, then the run along it.
+func hitTest(runs []textRun, p image.Point) (textPos, bool) {
+	if len(runs) == 0 {
+		return textPos{}, false
+	}
+	best, bestDist := 0, -1
+	for i, r := range runs {
+		if i > 0 && runs[i-1].line == r.line {
+			continue
+		}
+		dist := rectDistance(lineRect(runs, i), p)
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	i := best
+	for ; i+1 < len(runs) && runs[i+1].line == runs[i].line; i++ {
+		next := runs[i+1]
+		if p.X < next.rect.Min.X {
+			// In the gap between two runs, the nearest one wins.
+			if p.X-runs[i].rect.Max.X > next.rect.Min.X-p.X {
+				return textPos{i + 1, 0}, true
+			}
+			break
+		}
+	}
+	r := runs[i]
+	return textPos{i, r.box.hitTest(fixed.I(p.X - r.rect.Min.X))}, true
+}
+
+// lineRect returns the rectangle of the runs on the line of the ith run.
+func lineRect(runs []textRun, i int) image.Rectangle {
+	rect := runs[i].rect
+	for j := i + 1; j < len(runs) && runs[j].line == runs[i].line; j++ {
+		rect = rect.Union(runs[j].rect)
+	}
+	return rect
+}
+
+// rectDistance returns the square of the distance from p to a rectangle.
+func rectDistance(r image.Rectangle, p image.Point) int {
+	dx := maxInt(0, maxInt(r.Min.X-p.X, p.X-r.Max.X+1))
+	dy := maxInt(0, maxInt(r.Min.Y-p.Y, p.Y-r.Max.Y+1))
+	return dx*dx + dy*dy
+}
+
+// wordAt returns the word around a position.  Words of text are whole runs;
+// in code, a word is a run of letters and digits, or of other non-space
+// characters.
+func wordAt(runs []textRun, pos textPos) (textPos, textPos) {
+	r := runs[pos.run]
+	if !r.code {
+		return textPos{pos.run, 0}, textPos{pos.run, len(r.text)}
+	}
+	class := func(c rune) int {
+		switch {
+		case unicode.IsSpace(c):
+			return 0
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c):
+			return 1
+		}
+		return 2
+	}
+	at := minInt(pos.offset, len(r.text)-1)
+	if at < 0 {
+		return pos, pos
+	}
+	c := class(r.text[at])
+	start, end := at, at+1
+	for start > 0 && class(r.text[start-1]) == c {
+		start--
+	}
+	for end < len(r.text) && class(r.text[end]) == c {
+		end++
+	}
+	return textPos{pos.run, start}, textPos{pos.run, end}
+}
+
+// paragraphAt returns the paragraph around a position, or the line for code.
+func paragraphAt(runs []textRun, pos textPos) (textPos, textPos) {
+	same := func(i, j int) bool {
+		if runs[i].code {
+			return runs[i].para == runs[j].para && (runs[i].line == runs[j].line || runs[maxInt(i, j)].wrapped)
+		}
+		return runs[i].para == runs[j].para
+	}
+	start, end := pos.run, pos.run
+	for start > 0 && same(start-1, start) {
+		start--
+	}
+	for end+1 < len(runs) && same(end, end+1) {
+		end++
+	}
+	return textPos{start, 0}, textPos{end, len(runs[end].text)}
+}
+
+// A selection is a range of text between where it started and where it
+// ends, in either order.
+type selection struct {
+	anchor, focus textPos
+}
+
+func (s selection) ordered() (textPos, textPos) {
+	if s.focus.before(s.anchor) {
+		return s.focus, s.anchor
+	}
+	return s.anchor, s.focus
+}
+
+// apply marks the selected text of the runs, to be drawn over clr.
+func (s selection) apply(runs []textRun, clr color.Color) {
+	markRange(runs, s.anchor, s.focus, clr)
+}
+
+// markRange marks the text between two positions, in either order.
+func markRange(runs []textRun, start, end textPos, clr color.Color) {
+	if end.before(start) {
+		start, end = end, start
+	}
+	for i := start.run; i <= end.run && i < len(runs); i++ {
+		lo, hi := 0, len(runs[i].text)
+		if i == start.run {
+			lo = start.offset
+		}
+		if i == end.run {
+			hi = end.offset
+		}
+		runs[i].box.mark(lo, hi, clr)
+	}
+}
+
+// text returns the selected text.  Words are separated by spaces, paragraphs
+// by blank lines, and code is kept as is.
+func (s selection) text(runs []textRun) string {
+	start, end := s.ordered()
+	var sb strings.Builder
+	for i := start.run; i <= end.run && i < len(runs); i++ {
+		r := runs[i]
+		lo, hi := 0, len(r.text)
+		if i == start.run {
+			lo = start.offset
+		}
+		if i == end.run {
+			hi = end.offset
+		}
+		if i > start.run {
+			sb.WriteString(runSeparator(runs[i-1], r))
+		}
+		sb.WriteString(r.box.copyText(lo, hi))
+	}
+	return sb.String()
+}
+
+func runSeparator(prev, r textRun) string {
+	switch {
+	case prev.para != r.para:
+		return "\n\n"
+	case !r.code:
+		return " "
+	case prev.line == r.line || r.wrapped:
+		return ""
+	}
+	return "\n"
+}
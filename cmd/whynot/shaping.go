@@ -0,0 +1,368 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+	"unicode"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+	"golang.org/x/text/unicode/bidi"
+)
+
+// A GlyphRun is a piece of text shaped into glyphs positioned relative to the
+// origin of the run.  Measuring and drawing text both go through it so they
+// always agree.
+type GlyphRun struct {
+	Glyphs  []PositionedGlyph
+	Bounds  fixed.Rectangle26_6
+	Advance fixed.Int26_6
+}
+
+type PositionedGlyph struct {
+	Index   sfnt.GlyphIndex
+	Pos     fixed.Point26_6
+	Cluster int           // index of the first rune the glyph comes from
+	Advance fixed.Int26_6 // 0 for marks
+}
+
+var (
+	tagCcmp = makeTag("ccmp")
+	tagIsol = makeTag("isol")
+	tagFina = makeTag("fina")
+	tagMedi = makeTag("medi")
+	tagInit = makeTag("init")
+	tagRlig = makeTag("rlig")
+	tagLiga = makeTag("liga")
+	tagClig = makeTag("clig")
+)
+
+// Shape maps text to glyphs, applies the substitutions of the font (glyph
+// composition, Arabic positional forms and ligatures) and positions the
+// glyphs with the font's kerning and mark attachment.  Right to left text is
+// given in logical order and the returned glyphs are in visual order.
+func (f *Face) Shape(text string, rtl bool) *GlyphRun {
+	runes := []rune(text)
+	glyphs := make([]shapingGlyph, len(runes))
+	for i, r := range runes {
+		if rtl {
+			r = mirrorRune(r)
+		}
+		index, _ := f.font.GlyphIndex(&f.buf, r)
+		glyphs[i] = shapingGlyph{
+			index:   index,
+			cluster: i,
+			mark:    unicode.In(r, unicode.Mn, unicode.Me),
+		}
+	}
+
+	script := runesScript(runes)
+	if script == tagArab {
+		setArabicForms(runes, glyphs)
+	}
+	glyphs = f.gsub.apply(glyphs, script, tagCcmp, 0)
+	if script == tagArab {
+		for _, form := range []uint32{tagIsol, tagFina, tagMedi, tagInit} {
+			glyphs = f.gsub.apply(glyphs, script, form, form)
+		}
+	}
+	for _, feature := range []uint32{tagRlig, tagLiga, tagClig} {
+		glyphs = f.gsub.apply(glyphs, script, feature, 0)
+	}
+	if rtl {
+		reverseClusters(glyphs)
+	}
+	return f.position(glyphs, script)
+}
+
+func (f *Face) position(glyphs []shapingGlyph, script uint32) *GlyphRun {
+	run := &GlyphRun{Glyphs: make([]PositionedGlyph, 0, len(glyphs))}
+	var pen, baseAdvance fixed.Int26_6
+	base := -1
+	for _, g := range glyphs {
+		advance, _ := f.font.GlyphAdvance(&f.buf, g.index, f.ppem, f.hinting)
+		pos := fixed.Point26_6{X: pen}
+		if g.mark && base >= 0 {
+			b := run.Glyphs[base]
+			if dx, dy, ok := f.gpos.markOffset(script, b.Index, g.index); ok {
+				pos = fixed.Point26_6{X: b.Pos.X + f.fromUnits(dx), Y: b.Pos.Y - f.fromUnits(dy)}
+			} else if advance != 0 {
+				// Spacing marks with no attachment data are centered on
+				// their base.
+				pos.X = b.Pos.X + (baseAdvance-advance)/2
+			}
+			advance = 0
+		} else {
+			if base >= 0 {
+				left := run.Glyphs[base].Index
+				if kern, ok := f.gpos.pairKerning(script, left, g.index); ok {
+					pen += f.fromUnits(kern)
+				} else if kern, err := f.font.Kern(&f.buf, left, g.index, f.ppem, f.hinting); err == nil {
+					pen += kern
+				}
+				pos.X = pen
+			}
+			base = len(run.Glyphs)
+			baseAdvance = advance
+		}
+		if bounds, _, err := f.font.GlyphBounds(&f.buf, g.index, f.ppem, f.hinting); err == nil {
+			run.Bounds = run.Bounds.Union(bounds.Add(pos))
+		}
+		run.Glyphs = append(run.Glyphs, PositionedGlyph{Index: g.index, Pos: pos, Cluster: g.cluster, Advance: advance})
+		pen += advance
+	}
+	run.Advance = pen
+	return run
+}
+
+func (f *Face) fromUnits(v int) fixed.Int26_6 {
+	return fixed.Int26_6(int64(v) * int64(f.ppem) / int64(f.font.UnitsPerEm()))
+}
+
+// Carets returns the advance of each rune boundary of the n runes the run was
+// shaped from, in logical order.  A glyph made from several runes, such as a
+// ligature, is divided evenly between them.
+func (r *GlyphRun) Carets(n int, rtl bool) []fixed.Int26_6 {
+	type span struct {
+		cluster int
+		start   fixed.Int26_6
+		advance fixed.Int26_6
+	}
+	var spans []span
+	for _, g := range r.Glyphs {
+		if g.Advance == 0 {
+			continue
+		}
+		start := g.Pos.X
+		if rtl {
+			start = r.Advance - g.Pos.X - g.Advance
+		}
+		spans = append(spans, span{g.Cluster, start, g.Advance})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].cluster < spans[j].cluster })
+	carets := make([]fixed.Int26_6, n+1)
+	carets[n] = r.Advance
+	for i, s := range spans {
+		end := n
+		if i+1 < len(spans) {
+			end = spans[i+1].cluster
+		}
+		for j := s.cluster; j < end && j < n; j++ {
+			carets[j] = s.start + s.advance*fixed.Int26_6(j-s.cluster)/fixed.Int26_6(end-s.cluster)
+		}
+	}
+	return carets
+}
+
+// Draw draws the run with its origin on the baseline at (x, y).  Glyphs are
+// placed at subpixel horizontal offsets.
+func (r *GlyphRun) Draw(dst *ebiten.Image, face *Face, x, y fixed.Int26_6, clr color.Color) {
+	for _, g := range r.Glyphs {
+		gx, gy := x+g.Pos.X, y+g.Pos.Y
+		phase := subpixelPhase(gx)
+		img := face.glyphImage(g.Index, phase)
+		if img == nil {
+			continue
+		}
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Translate(
+			float64((gx-phase).Round()+img.offset.X),
+			float64(gy.Round()+img.offset.Y),
+		)
+		op.ColorM.ScaleWithColor(clr)
+		dst.DrawImage(img.image, op)
+	}
+}
+
+// Glyphs are rasterized at this many horizontal subpixel positions.
+const subpixelSteps = 4
+
+// subpixelPhase returns the fractional part of x rounded to the nearest
+// subpixel step, so that x - subpixelPhase(x) is a whole number of pixels.
+func subpixelPhase(x fixed.Int26_6) fixed.Int26_6 {
+	const step = 64 / subpixelSteps
+	q := (x + step/2) &^ (step - 1)
+	return q & 63
+}
+
+// A glyphImage is the rasterized mask of a glyph, with the position of its top
+// left corner relative to the glyph origin.
+type glyphImage struct {
+	image  *ebiten.Image
+	offset image.Point
+}
+
+type glyphKey struct {
+	index sfnt.GlyphIndex
+	phase fixed.Int26_6
+}
+
+func (f *Face) glyphImage(index sfnt.GlyphIndex, phase fixed.Int26_6) *glyphImage {
+	key := glyphKey{index, phase}
+	if img, ok := f.glyphs[key]; ok {
+		return img
+	}
+	img := f.rasterizeGlyph(index, phase)
+	f.glyphs[key] = img
+	return img
+}
+
+func (f *Face) rasterizeGlyph(index sfnt.GlyphIndex, phase fixed.Int26_6) *glyphImage {
+	segments, err := f.font.LoadGlyph(&f.buf, index, f.ppem, nil)
+	if err != nil {
+		return nil
+	}
+	dr := pixelBounds(segments.Bounds().Add(fixed.Point26_6{X: phase}))
+	if dr.Empty() {
+		return nil
+	}
+	biasX := phase - fixed.Int26_6(dr.Min.X<<6)
+	biasY := -fixed.Int26_6(dr.Min.Y << 6)
+	pt := func(p fixed.Point26_6) (float32, float32) {
+		return float32(p.X+biasX) / 64, float32(p.Y+biasY) / 64
+	}
+	rast := vector.NewRasterizer(dr.Dx(), dr.Dy())
+	rast.DrawOp = draw.Src
+	for _, seg := range segments {
+		switch seg.Op {
+		case sfnt.SegmentOpMoveTo:
+			rast.MoveTo(pt(seg.Args[0]))
+		case sfnt.SegmentOpLineTo:
+			rast.LineTo(pt(seg.Args[0]))
+		case sfnt.SegmentOpQuadTo:
+			x1, y1 := pt(seg.Args[0])
+			x2, y2 := pt(seg.Args[1])
+			rast.QuadTo(x1, y1, x2, y2)
+		case sfnt.SegmentOpCubeTo:
+			x1, y1 := pt(seg.Args[0])
+			x2, y2 := pt(seg.Args[1])
+			x3, y3 := pt(seg.Args[2])
+			rast.CubeTo(x1, y1, x2, y2, x3, y3)
+		}
+	}
+	mask := image.NewAlpha(image.Rect(0, 0, dr.Dx(), dr.Dy()))
+	rast.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+	return &glyphImage{
+		image:  ebiten.NewImageFromImage(mask),
+		offset: dr.Min,
+	}
+}
+
+// mirrorRune returns the mirrored counterpart of a bracket, for display in
+// right to left text.
+func mirrorRune(r rune) rune {
+	if props, _ := bidi.LookupRune(r); !props.IsBracket() {
+		return r
+	}
+	for _, m := range bidi.ReverseString(string(r)) {
+		return m
+	}
+	return r
+}
+
+// reverseClusters puts right to left glyphs in visual order, keeping marks
+// after the base glyph they attach to.
+func reverseClusters(glyphs []shapingGlyph) {
+	reverseSlice(glyphs)
+	for i := 0; i < len(glyphs); {
+		j := i
+		for j < len(glyphs) && glyphs[j].mark {
+			j++
+		}
+		if j < len(glyphs) {
+			j++
+		}
+		reverseSlice(glyphs[i:j])
+		i = j
+	}
+}
+
+func runesScript(runes []rune) uint32 {
+	for _, r := range runes {
+		switch {
+		case unicode.Is(unicode.Arabic, r):
+			return tagArab
+		case unicode.Is(unicode.Hebrew, r):
+			return tagHebr
+		case unicode.IsLetter(r):
+			return tagLatn
+		}
+	}
+	return tagLatn
+}
+
+type joiningType int
+
+const (
+	joinNone joiningType = iota
+	joinRight
+	joinDual
+	joinCausing
+	joinTransparent
+)
+
+var rightJoiningArabic = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x0622, 0x0625, 1}, {0x0627, 0x0629, 2}, {0x062F, 0x0632, 1},
+		{0x0648, 0x0648, 1}, {0x0671, 0x0673, 1}, {0x0675, 0x0677, 1},
+		{0x0688, 0x0699, 1}, {0x06C0, 0x06C0, 1}, {0x06C3, 0x06CB, 1},
+		{0x06CD, 0x06CF, 2}, {0x06D2, 0x06D3, 1}, {0x06D5, 0x06D5, 1},
+		{0x06EE, 0x06EF, 1},
+	},
+}
+
+func arabicJoiningType(r rune) joiningType {
+	switch {
+	case r == 0x0640 || r == 0x200D:
+		return joinCausing
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return joinTransparent
+	case r == 0x0621:
+		return joinNone
+	case unicode.Is(rightJoiningArabic, r):
+		return joinRight
+	case unicode.Is(unicode.Arabic, r) && unicode.IsLetter(r):
+		return joinDual
+	}
+	return joinNone
+}
+
+// setArabicForms works out which positional form each Arabic letter takes
+// from the joining types of its neighbours.  It must run before any
+// substitution, while glyphs and runes still correspond one to one.
+func setArabicForms(runes []rune, glyphs []shapingGlyph) {
+	types := make([]joiningType, len(runes))
+	for i, r := range runes {
+		types[i] = arabicJoiningType(r)
+	}
+	neighbour := func(i, step int) joiningType {
+		for i += step; i >= 0 && i < len(types); i += step {
+			if types[i] != joinTransparent {
+				return types[i]
+			}
+		}
+		return joinNone
+	}
+	for i, t := range types {
+		if t != joinRight && t != joinDual {
+			continue
+		}
+		prev, next := neighbour(i, -1), neighbour(i, 1)
+		joinsPrev := prev == joinDual || prev == joinCausing
+		joinsNext := t == joinDual && (next == joinRight || next == joinDual || next == joinCausing)
+		switch {
+		case joinsPrev && joinsNext:
+			glyphs[i].form = tagMedi
+		case joinsPrev:
+			glyphs[i].form = tagFina
+		case joinsNext:
+			glyphs[i].form = tagInit
+		default:
+			glyphs[i].form = tagIsol
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	gmast "github.com/yuin/goldmark/ast"
+)
+
+// A SlideStyle describes the slides of presentation mode.  Sizes are
+// unscaled.  Slides are laid out at the given size, or taller if their
+// content needs it, and then scaled to fit the window.
+type SlideStyle struct {
+	Width, Height float64
+	Margins       Margins
+	Background    color.Color
+	Letterbox     color.Color // around the slide
+	CounterStyle  TextStyle
+	CounterColor  color.Color
+	NotesStyle    partStyle
+	NotesColor    color.Color
+}
+
+// A slide is a part of a document shown on its own, with notes for the
+// speaker.
+type slide struct {
+	block Block
+	notes []string
+}
+
+// parseSlides splits a document into slides at thematic breaks and at level 1
+// and 2 headings.  HTML comments are the notes of the slide they are in, or
+// of the previous slide if there is nothing else in theirs.
+func parseSlides(source []byte, dir string, theme Theme) []slide {
+	compiler := MarkdownCompiler{
+		source: source,
+		dir:    dir,
+		Theme:  theme,
+	}
+	var slides []slide
+	var nodes []gmast.Node
+	flush := func() {
+		blocks := compiler.CompileSection(nodes)
+		notes := compiler.takeNotes()
+		switch {
+		case len(blocks) > 0 || len(slides) == 0 && len(notes) > 0:
+			slides = append(slides, slide{&StackBlock{blocks: blocks}, notes})
+		case len(slides) > 0:
+			last := &slides[len(slides)-1]
+			last.notes = append(last.notes, notes...)
+		}
+		nodes = nil
+	}
+	doc := parseMarkdownTree(source)
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		switch n := child.(type) {
+		case *gmast.ThematicBreak:
+			flush()
+			continue
+		case *gmast.Heading:
+			if n.Level <= 2 && hasContent(nodes) {
+				flush()
+			}
+		}
+		nodes = append(nodes, child)
+	}
+	flush()
+	return slides
+}
+
+// hasContent reports whether nodes have more than HTML, which isn't shown.
+func hasContent(nodes []gmast.Node) bool {
+	for _, n := range nodes {
+		if n.Kind() != gmast.KindHTMLBlock {
+			return true
+		}
+	}
+	return false
+}
+
+// A presentation shows the slides of a document one at a time.  The slide is
+// rendered on a canvas that is scaled to fit the window.
+type presentation struct {
+	slides    []slide
+	current   int
+	showNotes bool
+	canvas    *ebiten.Image
+}
+
+func (p *presentation) setSlides(slides []slide) {
+	p.slides = slides
+	p.current = clampInt(p.current, 0, maxInt(len(slides)-1, 0))
+}
+
+// step moves by n slides, staying within the deck.
+func (p *presentation) step(n int) {
+	p.current = clampInt(p.current+n, 0, maxInt(len(p.slides)-1, 0))
+}
+
+func (p *presentation) Draw(dst *ebiten.Image, ctx RenderingContext, style SlideStyle) {
+	dst.Fill(style.Letterbox)
+	if len(p.slides) == 0 {
+		return
+	}
+	s := p.slides[p.current]
+	width := int(math.Round(style.Width * ctx.Scale))
+	margins := ctx.ScaleMargins(style.Margins)
+	left, top := int(margins.Left), int(margins.Top)
+	box := s.block.Layout(ctx, Constraints{Width: width - left - int(margins.Right)})
+	height := maxInt(int(math.Round(style.Height*ctx.Scale)), top+box.Bounds().Dy()+int(margins.Bottom))
+	if p.canvas == nil || p.canvas.Bounds().Size() != image.Pt(width, height) {
+		if p.canvas != nil {
+			p.canvas.Dispose()
+		}
+		p.canvas = ebiten.NewImage(width, height)
+	}
+	p.canvas.Fill(style.Background)
+	box.Draw(p.canvas, left, top)
+
+	bounds := dst.Bounds()
+	scale := math.Min(float64(bounds.Dx())/float64(width), float64(bounds.Dy())/float64(height))
+	op := &ebiten.DrawImageOptions{Filter: ebiten.FilterLinear}
+	op.GeoM.Scale(scale, scale)
+	op.GeoM.Translate((float64(bounds.Dx())-float64(width)*scale)/2, (float64(bounds.Dy())-float64(height)*scale)/2)
+	dst.DrawImage(p.canvas, op)
+
+	counter := textLine(ctx, style.CounterStyle, style.CounterColor, fmt.Sprintf("%d / %d", p.current+1, len(p.slides)))
+	gap := gapWidth(ctx, style.CounterStyle)
+	counter.Draw(dst, bounds.Max.X-counter.Bounds().Dx()-2*gap, bounds.Max.Y-counter.Bounds().Dy()-gap)
+
+	if p.showNotes && len(s.notes) > 0 {
+		notes := p.notesBox(ctx, style, s.notes, bounds.Dx())
+		notes.Draw(dst, bounds.Min.X, bounds.Max.Y-notes.Bounds().Dy())
+	}
+}
+
+// notesBox lays out the notes of a slide, a paragraph for each blank-line
+// separated part.
+func (p *presentation) notesBox(ctx RenderingContext, style SlideStyle, notes []string, width int) Box {
+	var blocks []Block
+	for _, note := range notes {
+		for _, para := range strings.Split(note, "\n\n") {
+			parts := appendString(nil, para, style.NotesStyle.TextStyle, style.NotesColor)
+			if len(parts) == 0 {
+				continue
+			}
+			blocks = append(blocks, &TextBlock{
+				margins:    style.NotesStyle.Margins,
+				parts:      parts,
+				level:      resolveBidiLevels(parts),
+				lineHeight: style.NotesStyle.LineHeight,
+			})
+		}
+	}
+	return decorate(ctx, style.NotesStyle.Decoration, width, func(width int) Box {
+		return (&StackBlock{blocks: blocks}).Layout(ctx, Constraints{Width: width})
+	})
+}
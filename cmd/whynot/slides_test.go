@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	gmast "github.com/yuin/goldmark/ast"
+)
+
+func TestParseSlides(t *testing.T) {
+	tests := []struct {
+		source string
+		blocks []int // the number of blocks of each slide
+		notes  [][]string
+	}{
+		{"", nil, nil},
+		{"# A\n\ntext\n\n---\n\nmore\n", []int{2, 1}, [][]string{nil, nil}},
+		// Level 1 and 2 headings start slides, smaller ones don't.
+		{"# A\n\n## B\n\n### C\n\ntext\n", []int{1, 3}, [][]string{nil, nil}},
+		// A heading right after a break doesn't make an empty slide.
+		{"text\n\n---\n\n# A\n", []int{1, 1}, [][]string{nil, nil}},
+		{
+			"# A\n\n<!-- note a -->\n\ntext\n\n# B\n\n<!-- b1 -->\n<!-- b2 -->\n",
+			[]int{2, 1},
+			[][]string{{"note a"}, {"b1", "b2"}},
+		},
+		// Notes alone between breaks belong to the slide before.
+		{
+			"# A\n\n---\n\n<!--\nmore for A\n-->\n\n---\n\n# B\n",
+			[]int{1, 1},
+			[][]string{{"more for A"}, nil},
+		},
+		// Notes before the first heading start the first slide.
+		{"<!-- intro -->\n\n# A\n\ntext\n", []int{2}, [][]string{{"intro"}}},
+		{"<!-- only -->\n", []int{0}, [][]string{{"only"}}},
+		// Empty comments aren't notes.
+		{"# A\n\n<!-- -->\n", []int{1}, [][]string{nil}},
+	}
+	for _, test := range tests {
+		slides := parseSlides([]byte(test.source), ".", DefaultTheme())
+		var blocks []int
+		var notes [][]string
+		for _, s := range slides {
+			blocks = append(blocks, len(s.block.(*StackBlock).blocks))
+			notes = append(notes, s.notes)
+		}
+		if !reflect.DeepEqual(blocks, test.blocks) || !reflect.DeepEqual(notes, test.notes) {
+			t.Errorf("parseSlides(%q) = slides of %v blocks with notes %q, want %v with %q",
+				test.source, blocks, notes, test.blocks, test.notes)
+		}
+	}
+}
+
+func TestHasContent(t *testing.T) {
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{"", false},
+		{"<!-- a note -->\n", false},
+		{"<!-- a -->\n\n<div>b</div>\n", false},
+		{"<!-- a note -->\n\ntext\n", true},
+		{"# Title\n", true},
+	}
+	for _, test := range tests {
+		var nodes []gmast.Node
+		doc := parseMarkdownTree([]byte(test.source))
+		for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+			nodes = append(nodes, child)
+		}
+		if got := hasContent(nodes); got != test.want {
+			t.Errorf("hasContent(%q) = %t, want %t", test.source, got, test.want)
+		}
+	}
+}
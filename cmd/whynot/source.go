@@ -0,0 +1,112 @@
+package main
+
+import "image"
+
+// Blocks compiled from the source remember the line they start on, so that
+// the view can stay on the same content when the source is reloaded.
+type sourcePos struct {
+	line int // from 1, or 0 if unknown
+}
+
+func (p sourcePos) SourceLine() int {
+	return p.line
+}
+
+func (p *sourcePos) setSourceLine(line int) {
+	p.line = line
+}
+
+// Blocks that know where they start in the source implement this.
+type sourceLined interface {
+	SourceLine() int
+}
+
+// An AnchorBox is the box of a block that starts on a known line of the
+// source.
+type AnchorBox struct {
+	Box
+	line int
+}
+
+func (b *AnchorBox) SplitAt(height int) (Box, Box) {
+	first, rest := splitBox(b.Box, height)
+	switch {
+	case first == nil:
+		return nil, b
+	case rest == nil:
+		return b, nil
+	}
+	return &AnchorBox{first, b.line}, &AnchorBox{rest, b.line}
+}
+
+func (b *AnchorBox) Children() []ChildBox {
+	return []ChildBox{{Box: b.Box}}
+}
+
+// A sourceAnchor is where the box of a source line is in the document.
+type sourceAnchor struct {
+	line int
+	rect image.Rectangle
+}
+
+// boxAnchors returns the anchors in a box, in document order, given that the
+// box is at pos.  Nested blocks come after the block that contains them.
+func boxAnchors(box Box, pos image.Point) []sourceAnchor {
+	var anchors []sourceAnchor
+	if a, ok := box.(*AnchorBox); ok {
+		anchors = append(anchors, sourceAnchor{a.line, a.Bounds().Add(pos)})
+	}
+	if parent, ok := box.(ParentBox); ok {
+		for _, child := range parent.Children() {
+			anchors = append(anchors, boxAnchors(child.Box, pos.Add(child.Pos))...)
+		}
+	}
+	return anchors
+}
+
+// A sourceLocation is a vertical position in the document relative to the
+// source: a line and how far down the box of that line.
+type sourceLocation struct {
+	line     int
+	fraction float64
+}
+
+// locate returns the source location of a vertical position: the innermost
+// block at y, or the last one that starts above it.
+func locate(anchors []sourceAnchor, y int) (sourceLocation, bool) {
+	found := -1
+	for i, a := range anchors {
+		if a.rect.Min.Y <= y && (found < 0 || y < a.rect.Max.Y || anchors[found].rect.Max.Y <= y) {
+			found = i
+		}
+	}
+	if found < 0 {
+		return sourceLocation{}, false
+	}
+	a := anchors[found]
+	loc := sourceLocation{line: a.line}
+	if h := a.rect.Dy(); h > 0 {
+		loc.fraction = float64(minInt(y-a.rect.Min.Y, h)) / float64(h)
+	}
+	return loc, true
+}
+
+// position returns the vertical position of a source location: within the
+// block of the same line, or at the start of the nearest block before it if
+// that line is gone.
+func (loc sourceLocation) position(anchors []sourceAnchor) (int, bool) {
+	found := -1
+	for i, a := range anchors {
+		if a.line <= loc.line && (found < 0 || a.line >= anchors[found].line) {
+			found = i
+		}
+	}
+	if found < 0 {
+		return 0, false
+	}
+	a := anchors[found]
+	if a.line != loc.line {
+		return a.rect.Min.Y, true
+	}
+	return a.rect.Min.Y + int(loc.fraction*float64(a.rect.Dy())), true
+}
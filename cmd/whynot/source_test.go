@@ -0,0 +1,115 @@
+package main
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func anchor(line, top, bottom int) sourceAnchor {
+	return sourceAnchor{line, image.Rect(0, top, 100, bottom)}
+}
+
+// A document with a list starting on line 5, whose items start on lines 5
+// and 7, between paragraphs on lines 1 and 10.
+var testAnchors = []sourceAnchor{
+	anchor(1, 0, 40),
+	anchor(5, 50, 110),
+	anchor(5, 50, 80),
+	anchor(7, 80, 110),
+	anchor(10, 120, 200),
+}
+
+func TestLocate(t *testing.T) {
+	tests := []struct {
+		y    int
+		want sourceLocation
+		ok   bool
+	}{
+		{0, sourceLocation{1, 0}, true},
+		{10, sourceLocation{1, 0.25}, true},
+		// Between blocks, the last one that starts above.
+		{45, sourceLocation{1, 1}, true},
+		// The innermost block.
+		{65, sourceLocation{5, 0.5}, true},
+		{95, sourceLocation{7, 0.5}, true},
+		{160, sourceLocation{10, 0.5}, true},
+		{300, sourceLocation{10, 1}, true},
+		{-10, sourceLocation{}, false},
+	}
+	for _, test := range tests {
+		got, ok := locate(testAnchors, test.y)
+		if got != test.want || ok != test.ok {
+			t.Errorf("locate(%d) = %v, %t, want %v, %t", test.y, got, ok, test.want, test.ok)
+		}
+	}
+	if _, ok := locate(nil, 0); ok {
+		t.Errorf("located a position without anchors")
+	}
+}
+
+func TestPosition(t *testing.T) {
+	tests := []struct {
+		loc  sourceLocation
+		want int
+		ok   bool
+	}{
+		{sourceLocation{1, 0.5}, 20, true},
+		{sourceLocation{7, 0}, 80, true},
+		{sourceLocation{10, 0.25}, 140, true},
+		// Lines that are gone go to the block before them.
+		{sourceLocation{3, 0.5}, 0, true},
+		{sourceLocation{8, 0.5}, 80, true},
+		{sourceLocation{50, 0.5}, 120, true},
+		{sourceLocation{0, 0}, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := test.loc.position(testAnchors)
+		if got != test.want || ok != test.ok {
+			t.Errorf("%v.position() = %d, %t, want %d, %t", test.loc, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestLocateAndPositionRoundTrip(t *testing.T) {
+	for y := 0; y < 200; y++ {
+		loc, ok := locate(testAnchors, y)
+		if !ok {
+			t.Fatalf("locate(%d) failed", y)
+		}
+		got, ok := loc.position(testAnchors)
+		if y >= 40 && y < 50 || y >= 110 && y < 120 {
+			// Gaps between blocks go to the end of the block above.
+			continue
+		}
+		if !ok || got != y {
+			t.Errorf("position of %v, located at %d, = %d", loc, y, got)
+		}
+	}
+}
+
+func TestBoxAnchors(t *testing.T) {
+	inner := &AnchorBox{line(10), 7}
+	box := &AnchorBox{&StackBox{boxes: []Box{line(20), inner}}, 5}
+	got := boxAnchors(box, image.Pt(3, 100))
+	want := []sourceAnchor{
+		{5, image.Rect(3, 100, 13, 130)},
+		{7, image.Rect(3, 120, 13, 130)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAnchorBoxSplitAt(t *testing.T) {
+	box := &AnchorBox{&StackBox{boxes: lines(3, 10)}, 4}
+	first, rest := box.SplitAt(15)
+	a, ok1 := first.(*AnchorBox)
+	b, ok2 := rest.(*AnchorBox)
+	if !ok1 || !ok2 || a.line != 4 || b.line != 4 {
+		t.Fatalf("got %v and %v, want both parts anchored to line 4", first, rest)
+	}
+	if a.Bounds().Dy() != 10 || b.Bounds().Dy() != 20 {
+		t.Errorf("got parts %d and %d high, want 10 and 20", a.Bounds().Dy(), b.Bounds().Dy())
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A document is what a tab shows: a Markdown file as compiled, and how it
+// is viewed.
+type document struct {
+	file   string
+	block  Block
+	zoom   float64 // on top of the scale of the device
+	scroll scroller
+
+	// The zoom level is saved once it is done changing.
+	zoomChanged bool
+
+	// The file is compiled again when it changes.  The view is then put
+	// back on the source line it was on.
+	modTime  time.Time
+	reanchor *sourceLocation
+
+	// The documents visited in the tab by following links.
+	history history
+}
+
+// openDocument reads and compiles a Markdown file, to be shown at the zoom
+// level last used for it.
+func openDocument(file string, theme Theme) (*document, error) {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	return &document{
+		file:    file,
+		block:   parseMarkdown(source, filepath.Dir(file), theme),
+		zoom:    loadZoom(file),
+		modTime: info.ModTime(),
+	}, nil
+}
+
+// keepZoom saves the zoom level of the document if it was changed.
+func (d *document) keepZoom() {
+	if !d.zoomChanged {
+		return
+	}
+	d.zoomChanged = false
+	if err := saveZoom(d.file, d.zoom); err != nil {
+		log.Print(err)
+	}
+}
+
+// A TabStyle is the style of the bar of tabs above the document.  The
+// decoration applies to the whole bar.
+type TabStyle struct {
+	partStyle
+	TabPadding        float64 // on either side of a title, unscaled
+	Color             color.Color
+	CurrentColor      color.Color
+	CurrentBackground color.Color
+}
+
+// A tabBar is a laid-out bar of tabs and where they are.
+type tabBar struct {
+	box  Box
+	tabs []image.Rectangle
+}
+
+// newTabBar lays out a tab for each document, titled with its file name,
+// with the current one highlighted.
+func newTabBar(ctx RenderingContext, style TabStyle, docs []*document, current int, width int) *tabBar {
+	bar := &tabBar{}
+	d := ctx.ScaleDecoration(style.Decoration)
+	insets := d.insets()
+	padding := int(style.TabPadding * ctx.Scale)
+	bar.box = decorate(ctx, style.Decoration, width, func(width int) Box {
+		var children []ChildBox
+		x := 0
+		for i, doc := range docs {
+			clr := style.Color
+			if i == current {
+				clr = style.CurrentColor
+			}
+			title := textLine(ctx, style.TextStyle, clr, filepath.Base(doc.file))
+			rect := image.Rect(x, 0, x+title.Bounds().Dx()+2*padding, title.Bounds().Dy())
+			if i == current {
+				children = append(children, ChildBox{Box: &FillBox{rect, style.CurrentBackground}})
+			}
+			children = append(children, ChildBox{Box: title, Pos: image.Pt(x+padding, 0)})
+			bar.tabs = append(bar.tabs, rect.Add(image.Pt(int(insets.Left), int(insets.Top))))
+			x = rect.Max.X
+		}
+		return NewGroupBox(children)
+	})
+	return bar
+}
+
+// tabAt returns the index of the tab at p, if any.
+func (b *tabBar) tabAt(p image.Point) (int, bool) {
+	for i, rect := range b.tabs {
+		if p.In(rect) {
+			return i, true
+		}
+	}
+	return 0, false
+}
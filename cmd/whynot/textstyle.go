@@ -15,6 +15,8 @@ import (
 	"golang.org/x/image/font/gofont/gosmallcaps"
 	"golang.org/x/image/font/gofont/gosmallcapsitalic"
 	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
 )
 
 type FontFamily int
@@ -33,19 +35,56 @@ type TextStyle struct {
 }
 
 type FaceSelector interface {
-	SelectFace(TextStyle) (font.Face, error)
+	SelectFace(TextStyle) (*Face, error)
 	SetDPI(float64)
 }
 
+// A Face is a font face together with the OpenType font it is made from, so
+// that text can be shaped with the font's layout tables.
+type Face struct {
+	font.Face
+	font    *sfnt.Font
+	ppem    fixed.Int26_6
+	hinting font.Hinting
+	gsub    gsubTable
+	gpos    gposTable
+	buf     sfnt.Buffer
+	glyphs  map[glyphKey]*glyphImage
+}
+
+type parsedFont struct {
+	font *sfnt.Font
+	gsub gsubTable
+	gpos gposTable
+}
+
+func newParsedFont(src []byte) (*parsedFont, error) {
+	f, err := opentype.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &parsedFont{
+		font: f,
+		gsub: gsubTable{otLayoutTable{findTable(src, tagGSUB)}},
+		gpos: gposTable{otLayoutTable{findTable(src, tagGPOS)}},
+	}, nil
+}
+
 type GoFontFaceSelector struct {
-	cache       map[TextStyle]font.Face
+	cache       map[TextStyle]*Face
+	fonts       map[TextStyle]*parsedFont
 	dpi         float64
 	fontHinting font.Hinting
+
+	// Replaces the Go fonts for proportional text if set.  The Go fonts
+	// have no layout tables and only cover Latin, Greek and Cyrillic.
+	proportional *parsedFont
 }
 
 func NewGoFontFaceSelector(dpi float64) *GoFontFaceSelector {
 	return &GoFontFaceSelector{
-		cache:       map[TextStyle]font.Face{},
+		cache:       map[TextStyle]*Face{},
+		fonts:       map[TextStyle]*parsedFont{},
 		dpi:         dpi,
 		fontHinting: font.HintingNone,
 	}
@@ -53,12 +92,24 @@ func NewGoFontFaceSelector(dpi float64) *GoFontFaceSelector {
 
 func (s *GoFontFaceSelector) SetDPI(dpi float64) {
 	if dpi != s.dpi {
-		s.cache = map[TextStyle]font.Face{}
+		s.cache = map[TextStyle]*Face{}
 		s.dpi = dpi
 	}
 }
 
-func (s *GoFontFaceSelector) SelectFace(style TextStyle) (font.Face, error) {
+// UseFont makes proportional text use an OpenType font, in all its weights
+// and styles, instead of the Go fonts.
+func (s *GoFontFaceSelector) UseFont(src []byte) error {
+	f, err := newParsedFont(src)
+	if err != nil {
+		return err
+	}
+	s.proportional = f
+	s.cache = map[TextStyle]*Face{}
+	return nil
+}
+
+func (s *GoFontFaceSelector) SelectFace(style TextStyle) (*Face, error) {
 	face, ok := s.cache[style]
 	if ok {
 		return face, nil
@@ -78,12 +129,11 @@ func (s *GoFontFaceSelector) SelectFace(style TextStyle) (font.Face, error) {
 		normStyle.Style = style.Style
 	}
 	normStyle.Family = style.Family
-	fontsrc := goFonts[normStyle]
-	goFont, err := opentype.Parse(fontsrc)
+	goFont, err := s.parseFont(normStyle)
 	if err != nil {
 		return nil, err
 	}
-	face, err = opentype.NewFace(goFont, &opentype.FaceOptions{
+	fontFace, err := opentype.NewFace(goFont.font, &opentype.FaceOptions{
 		Size:    style.Size,
 		DPI:     s.dpi,
 		Hinting: s.fontHinting,
@@ -91,10 +141,34 @@ func (s *GoFontFaceSelector) SelectFace(style TextStyle) (font.Face, error) {
 	if err != nil {
 		return nil, err
 	}
+	face = &Face{
+		Face:    fontFace,
+		font:    goFont.font,
+		ppem:    fixed.Int26_6(0.5 + style.Size*s.dpi*64/72),
+		hinting: s.fontHinting,
+		gsub:    goFont.gsub,
+		gpos:    goFont.gpos,
+		glyphs:  map[glyphKey]*glyphImage{},
+	}
 	s.cache[style] = face
 	return face, nil
 }
 
+func (s *GoFontFaceSelector) parseFont(normStyle TextStyle) (*parsedFont, error) {
+	if normStyle.Family == Proportional && s.proportional != nil {
+		return s.proportional, nil
+	}
+	if f, ok := s.fonts[normStyle]; ok {
+		return f, nil
+	}
+	f, err := newParsedFont(goFonts[normStyle])
+	if err != nil {
+		return nil, err
+	}
+	s.fonts[normStyle] = f
+	return f, nil
+}
+
 var goFonts = map[TextStyle][]byte{
 	{0, font.StyleNormal, font.WeightNormal, Proportional}: goregular.TTF,
 	{0, font.StyleItalic, font.WeightNormal, Proportional}: goitalic.TTF,
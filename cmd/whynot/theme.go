@@ -0,0 +1,305 @@
+package main
+
+import (
+	"image/color"
+
+	"golang.org/x/image/font"
+)
+
+// A Theme holds the styles used to compile a Markdown document into blocks.
+type Theme struct {
+	headingStyles  [6]partStyle
+	paragraphStyle partStyle
+	listItemStyle  partStyle
+	listStyle      partStyle
+	codeBlockStyle partStyle
+	quoteStyle     partStyle
+	codeColor      color.Color
+	linkColor      color.Color
+	figureStyle    partStyle
+	captionStyle   partStyle
+	captionColor   color.Color
+	floatStyle     partStyle
+	ruleStyle      partStyle
+	ruleColor      color.Color
+	floatMaxWidth  float64 // as a fraction of the column
+
+	// The document is laid out in a centered column no wider than this.
+	// Code blocks may break out of it if codeBlockBreakout is set.
+	measure           Measure
+	codeBlockBreakout bool
+
+	// The whole document can be laid out in columns, as well as sections
+	// whose heading has a columns attribute.  Headings within columns may
+	// span all of them.
+	columns      int
+	columnGap    float64
+	spanHeadings bool
+
+	// Tabs in code blocks are expanded to stops every tabWidth columns.  Long
+	// code lines scroll horizontally unless codeWrap is set, in which case
+	// they wrap and continuation lines start with a marker.
+	tabWidth int
+	codeWrap bool
+
+	syntaxPalette SyntaxPalette
+
+	// Used when the document is shown or exported page by page.
+	pageLayout PageLayout
+
+	// Used for line numbers and wrap markers in code blocks.
+	lineNumberColor color.Color
+	highlightColor  color.Color
+
+	// The bar at the top of the window showing the headings of the section
+	// being read.
+	breadcrumbStyle BreadcrumbStyle
+
+	// The side panel listing the headings.
+	tocStyle TOCStyle
+
+	// The side panel listing the files that can be opened, and the bar of
+	// tabs of the documents open.
+	fileTreeStyle TOCStyle
+	tabStyle      TabStyle
+
+	scrollbarStyle ScrollbarStyle
+
+	// Drawn behind selected text.
+	selectionColor color.Color
+
+	searchStyle SearchStyle
+
+	// Used in presentation mode.
+	slideStyle SlideStyle
+}
+
+type partStyle struct {
+	TextStyle
+	Margins
+	LineHeight  LineHeight
+	Decoration  Decoration
+	LevelOffset int
+}
+
+func DefaultTheme() Theme {
+	return Theme{
+		paragraphStyle: partStyle{
+			TextStyle:  TextStyle{Size: 16},
+			Margins:    Margins{Top: 10, Bottom: 10},
+			LineHeight: LineHeight{Multiplier: 1.5},
+		},
+		listItemStyle: partStyle{
+			TextStyle:  TextStyle{Size: 16},
+			Margins:    Margins{Top: 5, Bottom: 5, Left: 40},
+			LineHeight: LineHeight{Multiplier: 1.5},
+		},
+		listStyle: partStyle{
+			Margins: Margins{Top: 10, Bottom: 10},
+		},
+		headingStyles: [6]partStyle{
+			{
+				TextStyle:   TextStyle{Size: 40, Weight: font.WeightBold, Family: SmallCaps},
+				Margins:     Margins{Top: 30, Bottom: 10},
+				LineHeight:  LineHeight{Multiplier: 1.2},
+				LevelOffset: 2,
+			},
+			{
+				TextStyle:   TextStyle{Size: 36, Weight: font.WeightBold},
+				Margins:     Margins{Top: 26, Bottom: 10},
+				LineHeight:  LineHeight{Multiplier: 1.2},
+				LevelOffset: 2,
+			},
+			{
+				TextStyle:   TextStyle{Size: 32, Weight: font.WeightBold},
+				Margins:     Margins{Top: 22, Bottom: 10},
+				LineHeight:  LineHeight{Multiplier: 1.2},
+				LevelOffset: 2,
+			},
+			{
+				TextStyle:   TextStyle{Size: 28, Weight: font.WeightBold},
+				Margins:     Margins{Top: 18, Bottom: 10},
+				LineHeight:  LineHeight{Multiplier: 1.2},
+				LevelOffset: 2,
+			},
+			{
+				TextStyle:   TextStyle{Size: 24, Weight: font.WeightBold},
+				Margins:     Margins{Top: 14, Bottom: 10},
+				LineHeight:  LineHeight{Multiplier: 1.2},
+				LevelOffset: 2,
+			},
+			{
+				TextStyle:   TextStyle{Size: 20, Weight: font.WeightBold},
+				Margins:     Margins{Top: 10, Bottom: 10},
+				LineHeight:  LineHeight{Multiplier: 1.2},
+				LevelOffset: 2,
+			},
+		},
+		codeBlockStyle: partStyle{
+			TextStyle:  TextStyle{Size: 16, Family: Monospace},
+			Margins:    Margins{Top: 20, Bottom: 20, Left: 20, Right: 20},
+			LineHeight: LineHeight{Multiplier: 1.4},
+			Decoration: Decoration{
+				Padding:      Margins{Top: 10, Bottom: 10, Left: 14, Right: 14},
+				Background:   color.RGBA{0x2A, 0x2A, 0x33, 0xFF},
+				BorderRadius: 6,
+			},
+		},
+		quoteStyle: partStyle{
+			Margins: Margins{Top: 10, Bottom: 10, Left: 20, Right: 20},
+			Decoration: Decoration{
+				Padding:      Margins{Top: 4, Bottom: 4, Left: 16, Right: 16},
+				Background:   color.RGBA{0x1C, 0x22, 0x2A, 0xFF},
+				BorderWidth:  1,
+				BorderColor:  color.RGBA{0x50, 0x60, 0x70, 0xFF},
+				BorderRadius: 4,
+			},
+		},
+		codeColor: color.RGBA{0xFF, 0xFF, 0x80, 0xFF},
+		linkColor: color.RGBA{0x80, 0xB8, 0xFF, 0xFF},
+		figureStyle: partStyle{
+			Margins: Margins{Top: 20, Bottom: 20},
+		},
+		captionStyle: partStyle{
+			TextStyle:  TextStyle{Size: 14, Style: font.StyleItalic},
+			Margins:    Margins{Top: 8},
+			LineHeight: LineHeight{Multiplier: 1.4},
+		},
+		captionColor: color.Gray{Y: 0xB0},
+		floatStyle: partStyle{
+			Margins: Margins{Bottom: 10, Left: 16, Right: 16},
+		},
+		floatMaxWidth: 0.5,
+		ruleStyle: partStyle{
+			Margins: Margins{Top: 24, Bottom: 24},
+		},
+		ruleColor: color.Gray{Y: 0x50},
+		measure: Measure{
+			MaxWidth:      Length{Value: 42, Unit: Ems},
+			BreakoutWidth: Length{Value: 56, Unit: Ems},
+			EmSize:        16,
+		},
+		codeBlockBreakout: true,
+		columns:           1,
+		columnGap:         32,
+		spanHeadings:      true,
+		tabWidth:          4,
+		syntaxPalette: SyntaxPalette{
+			Keyword:  color.RGBA{0xFF, 0x7B, 0x72, 0xFF},
+			Type:     color.RGBA{0x79, 0xC0, 0xFF, 0xFF},
+			String:   color.RGBA{0xA5, 0xD6, 0xFF, 0xFF},
+			Number:   color.RGBA{0xFF, 0xA6, 0x57, 0xFF},
+			Comment:  color.RGBA{0x8B, 0x94, 0x9E, 0xFF},
+			Key:      color.RGBA{0x7E, 0xE7, 0x87, 0xFF},
+			Inserted: color.RGBA{0x7E, 0xE7, 0x87, 0xFF},
+			Deleted:  color.RGBA{0xFF, 0xA1, 0x98, 0xFF},
+			Meta:     color.RGBA{0xD2, 0xA8, 0xFF, 0xFF},
+		},
+		pageLayout: PageLayout{
+			Width:       794,
+			Height:      1123,
+			Margins:     Margins{Top: 64, Bottom: 64, Left: 72, Right: 72},
+			HeaderStyle: TextStyle{Size: 12, Style: font.StyleItalic},
+			HeaderColor: color.Gray{Y: 0x90},
+			Background:  color.RGBA{0x18, 0x18, 0x1C, 0xFF},
+		},
+		lineNumberColor: color.Gray{Y: 0x80},
+		highlightColor:  color.RGBA{0x45, 0x45, 0x30, 0xFF},
+		breadcrumbStyle: BreadcrumbStyle{
+			partStyle: partStyle{
+				TextStyle: TextStyle{Size: 13},
+				Decoration: Decoration{
+					Padding:    Margins{Top: 6, Bottom: 6, Left: 16, Right: 16},
+					Background: color.RGBA{0x10, 0x10, 0x14, 0xE0},
+				},
+			},
+			Color:          color.Gray{Y: 0xC0},
+			SeparatorColor: color.Gray{Y: 0x70},
+		},
+		tocStyle: TOCStyle{
+			partStyle: partStyle{
+				TextStyle: TextStyle{Size: 14},
+				Margins:   Margins{Bottom: 6},
+				Decoration: Decoration{
+					Padding:    Margins{Top: 16, Bottom: 16, Left: 16, Right: 16},
+					Background: color.RGBA{0x14, 0x14, 0x18, 0xFF},
+				},
+			},
+			Width:             260,
+			Indent:            14,
+			Color:             color.Gray{Y: 0xA0},
+			CurrentColor:      color.White,
+			CurrentBackground: color.RGBA{0x2A, 0x2A, 0x36, 0xFF},
+		},
+		fileTreeStyle: TOCStyle{
+			partStyle: partStyle{
+				TextStyle: TextStyle{Size: 14},
+				Margins:   Margins{Bottom: 6},
+				Decoration: Decoration{
+					Padding:    Margins{Top: 16, Bottom: 16, Left: 16, Right: 16},
+					Background: color.RGBA{0x10, 0x10, 0x14, 0xFF},
+				},
+			},
+			Width:             220,
+			Indent:            14,
+			Color:             color.Gray{Y: 0xA0},
+			CurrentColor:      color.White,
+			CurrentBackground: color.RGBA{0x2A, 0x2A, 0x36, 0xFF},
+		},
+		tabStyle: TabStyle{
+			partStyle: partStyle{
+				TextStyle: TextStyle{Size: 13},
+				Decoration: Decoration{
+					Padding:    Margins{Top: 6, Bottom: 6, Left: 8, Right: 8},
+					Background: color.RGBA{0x10, 0x10, 0x14, 0xFF},
+				},
+			},
+			TabPadding:        12,
+			Color:             color.Gray{Y: 0x90},
+			CurrentColor:      color.White,
+			CurrentBackground: color.RGBA{0x2A, 0x2A, 0x36, 0xFF},
+		},
+		scrollbarStyle: ScrollbarStyle{
+			Width:        10,
+			MinThumb:     24,
+			Track:        color.RGBA{0x14, 0x14, 0x18, 0xFF},
+			Thumb:        color.Gray{Y: 0x50},
+			MinimapWidth: 120,
+			MinimapView:  color.RGBA{0x30, 0x30, 0x40, 0x60},
+		},
+		selectionColor: color.RGBA{0x26, 0x4F, 0x78, 0xFF},
+		searchStyle: SearchStyle{
+			partStyle: partStyle{
+				TextStyle: TextStyle{Size: 14},
+				Decoration: Decoration{
+					Padding:    Margins{Top: 8, Bottom: 8, Left: 16, Right: 16},
+					Background: color.RGBA{0x10, 0x10, 0x14, 0xF0},
+				},
+			},
+			Color:        color.White,
+			LabelColor:   color.Gray{Y: 0x90},
+			ErrorColor:   color.RGBA{0xFF, 0x7B, 0x72, 0xFF},
+			Match:        color.RGBA{0x5A, 0x4A, 0x10, 0xFF},
+			CurrentMatch: color.RGBA{0xB0, 0x80, 0x10, 0xFF},
+		},
+		slideStyle: SlideStyle{
+			Width:        960,
+			Height:       540,
+			Margins:      Margins{Top: 48, Bottom: 48, Left: 64, Right: 64},
+			Background:   color.RGBA{0x18, 0x18, 0x1C, 0xFF},
+			Letterbox:    color.Black,
+			CounterStyle: TextStyle{Size: 13},
+			CounterColor: color.Gray{Y: 0x80},
+			NotesStyle: partStyle{
+				TextStyle:  TextStyle{Size: 15},
+				Margins:    Margins{Bottom: 8},
+				LineHeight: LineHeight{Multiplier: 1.4},
+				Decoration: Decoration{
+					Padding:    Margins{Top: 12, Bottom: 12, Left: 24, Right: 24},
+					Background: color.RGBA{0x10, 0x10, 0x14, 0xF0},
+				},
+			},
+			NotesColor: color.Gray{Y: 0xD0},
+		},
+	}
+}
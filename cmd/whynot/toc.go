@@ -0,0 +1,100 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// A TOCStyle is the style of the table of contents panel.  The decoration's
+// padding and background apply to the whole panel, and the bottom margin
+// separates entries.
+type TOCStyle struct {
+	partStyle
+	Width             float64 // unscaled
+	Indent            float64 // per heading level, unscaled
+	Color             color.Color
+	CurrentColor      color.Color
+	CurrentBackground color.Color
+}
+
+// A tocPanel is a laid-out table of contents and where its entries are.
+type tocPanel struct {
+	box     Box
+	entries []image.Rectangle
+	targets []headingPos
+	height  int // of the entries and padding, however far they are scrolled
+}
+
+// newTOCPanel lays out the headings as an indented tree, with the current one
+// highlighted, in a panel of the given size.  Entries are moved up by offset.
+func newTOCPanel(ctx RenderingContext, style TOCStyle, headings []headingPos, current int, size image.Point, offset int) *tocPanel {
+	items := make([]treeItem, len(headings))
+	for i, h := range headings {
+		items[i] = treeItem{h.title, h.level}
+	}
+	box, entries, height := layoutTree(ctx, style, items, current, size, offset)
+	return &tocPanel{box: box, entries: entries, targets: headings, height: height}
+}
+
+// A treeItem is an entry of a panel laid out as an indented tree.
+type treeItem struct {
+	title string
+	level int
+}
+
+// layoutTree lays out a panel of the given size listing items indented by
+// level, with the current one highlighted, and returns where the entries
+// are and how high they are with the padding.  Entries are moved up by
+// offset.
+func layoutTree(ctx RenderingContext, style TOCStyle, items []treeItem, current int, size image.Point, offset int) (Box, []image.Rectangle, int) {
+	padding := ctx.ScaleMargins(style.Decoration.Padding)
+	gap := int(math.Round(style.Bottom * ctx.Scale))
+	indent := style.Indent * ctx.Scale
+	minLevel := math.MaxInt32
+	for _, item := range items {
+		minLevel = minInt(minLevel, item.level)
+	}
+
+	var entries []image.Rectangle
+	children := []ChildBox{{Box: &FillBox{image.Rectangle{Max: size}, style.Decoration.Background}}}
+	y := int(padding.Top) - offset
+	for i, item := range items {
+		clr := style.Color
+		if i == current {
+			clr = style.CurrentColor
+		}
+		line := textLine(ctx, style.TextStyle, clr, item.title)
+		x := int(padding.Left + indent*float64(item.level-minLevel))
+		rect := image.Rect(0, y-gap/2, size.X, y+line.Bounds().Dy()+gap-gap/2)
+		if i == current {
+			children = append(children, ChildBox{Box: &FillBox{rect, style.CurrentBackground}})
+		}
+		children = append(children, ChildBox{Box: line, Pos: image.Pt(x, y)})
+		entries = append(entries, rect)
+		y += line.Bounds().Dy() + gap
+	}
+	return NewGroupBox(children), entries, y + offset + int(padding.Bottom)
+}
+
+// entryAt returns the heading of the entry at p, if any.
+func (p *tocPanel) entryAt(pt image.Point) (headingPos, bool) {
+	for i, rect := range p.entries {
+		if pt.In(rect) {
+			return p.targets[i], true
+		}
+	}
+	return headingPos{}, false
+}
+
+// currentHeading returns the index of the last heading at or above y, or -1.
+func currentHeading(headings []headingPos, y int) int {
+	current := -1
+	for i, h := range headings {
+		if h.pos.Y > y {
+			break
+		}
+		current = i
+	}
+	return current
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// Zoom levels go from minZoom to maxZoom in steps of zoomStep.
+const (
+	minZoom  = 0.5
+	maxZoom  = 4
+	zoomStep = 1.1
+)
+
+// stepZoom returns the zoom level steps away from zoom.  Levels near 1 snap
+// to it so that zooming in and out comes back to the natural size.
+func stepZoom(zoom float64, steps int) float64 {
+	zoom *= math.Pow(zoomStep, float64(steps))
+	if math.Abs(zoom-1) < 0.01 {
+		zoom = 1
+	}
+	return math.Max(minZoom, math.Min(maxZoom, zoom))
+}
+
+// The zoom level of each document is remembered in this file, under the
+// user's configuration directory, keyed by the absolute path of the document.
+const zoomFile = "whynot/zoom.json"
+
+func zoomPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.FromSlash(zoomFile)), nil
+}
+
+func readZoomLevels() (map[string]float64, error) {
+	path, err := zoomPath()
+	if err != nil {
+		return nil, err
+	}
+	levels := map[string]float64{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return levels, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &levels); err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+// loadZoom returns the zoom level last used for a document, or 1.
+func loadZoom(doc string) float64 {
+	levels, err := readZoomLevels()
+	if err != nil {
+		return 1
+	}
+	if abs, err := filepath.Abs(doc); err == nil {
+		if zoom, ok := levels[abs]; ok {
+			return math.Max(minZoom, math.Min(maxZoom, zoom))
+		}
+	}
+	return 1
+}
+
+// saveZoom remembers the zoom level of a document.  The natural size isn't
+// stored.
+func saveZoom(doc string, zoom float64) error {
+	abs, err := filepath.Abs(doc)
+	if err != nil {
+		return err
+	}
+	levels, err := readZoomLevels()
+	if err != nil {
+		return err
+	}
+	if zoom == 1 {
+		delete(levels, abs)
+	} else {
+		levels[abs] = zoom
+	}
+	data, err := json.MarshalIndent(levels, "", "\t")
+	if err != nil {
+		return err
+	}
+	path, err := zoomPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStepZoom(t *testing.T) {
+	tests := []struct {
+		zoom  float64
+		steps int
+		want  float64
+	}{
+		{1, 1, 1.1},
+		{1, -1, 1 / 1.1},
+		{1, 2, 1.21},
+		{1.1, -1, 1},
+		{1 / 1.1, 1, 1},
+		{1, 100, maxZoom},
+		{1, -100, minZoom},
+		{maxZoom, 1, maxZoom},
+		{2, 0, 2},
+	}
+	for _, test := range tests {
+		if got := stepZoom(test.zoom, test.steps); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("stepZoom(%g, %d) = %g, want %g", test.zoom, test.steps, got, test.want)
+		}
+	}
+}
+
+func TestStepZoomComesBack(t *testing.T) {
+	zoom := 1.0
+	for i := 0; i < 5; i++ {
+		zoom = stepZoom(zoom, 1)
+	}
+	for i := 0; i < 5; i++ {
+		zoom = stepZoom(zoom, -1)
+	}
+	if zoom != 1 {
+		t.Errorf("zooming in and out again gives %g, want 1", zoom)
+	}
+}
+
+// useConfigDir makes a temporary directory the user's configuration
+// directory for the test.
+func useConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("AppData", dir)
+	t.Setenv("HOME", dir)
+}
+
+func TestZoomRoundTrip(t *testing.T) {
+	useConfigDir(t)
+	docs := t.TempDir()
+	a, b := filepath.Join(docs, "a.md"), filepath.Join(docs, "b.md")
+	if got := loadZoom(a); got != 1 {
+		t.Errorf("zoom of a new document = %g, want 1", got)
+	}
+	if err := saveZoom(a, 1.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveZoom(b, 2); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadZoom(a); got != 1.5 {
+		t.Errorf("zoom of a = %g, want 1.5", got)
+	}
+	if got := loadZoom(b); got != 2 {
+		t.Errorf("zoom of b = %g, want 2", got)
+	}
+
+	// The natural size isn't stored.
+	if err := saveZoom(a, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadZoom(a); got != 1 {
+		t.Errorf("zoom of a reset = %g, want 1", got)
+	}
+	levels, err := readZoomLevels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := levels[a]; ok || len(levels) != 1 {
+		t.Errorf("levels = %v, want only b", levels)
+	}
+}
+
+func TestLoadZoomClamps(t *testing.T) {
+	useConfigDir(t)
+	path, err := zoomPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := filepath.Abs("doc.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(map[string]float64{doc: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadZoom("doc.md"); got != maxZoom {
+		t.Errorf("zoom = %g, want %g", got, float64(maxZoom))
+	}
+
+	// A file that can't be read gives the natural size.
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadZoom("doc.md"); got != 1 {
+		t.Errorf("zoom with a broken file = %g, want 1", got)
+	}
+	if err := saveZoom("doc.md", 2); err == nil {
+		t.Errorf("saving over a broken file didn't fail")
+	}
+}